@@ -0,0 +1,344 @@
+package ariotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+
+	"github.com/kahosan/aria2-rpc/resp"
+)
+
+// Notification methods sent by the server.
+const (
+	OnDownloadStart      = "aria2.onDownloadStart"
+	OnDownloadPause      = "aria2.onDownloadPause"
+	OnDownloadStop       = "aria2.onDownloadStop"
+	OnDownloadComplete   = "aria2.onDownloadComplete"
+	OnDownloadError      = "aria2.onDownloadError"
+	OnBtDownloadComplete = "aria2.onBtDownloadComplete"
+)
+
+type download struct {
+	gid             string
+	status          resp.DownloadStatus
+	uris            []string
+	options         map[string]string
+	totalLength     int64
+	completedLength int64
+	uploadLength    int64
+	downloadSpeed   int64
+	uploadSpeed     int64
+	errorCode       int
+	errorMessage    string
+	torrent         bool
+	infoHash        string
+	seeder          bool
+	followedBy      []string
+	following       string
+}
+
+func (d *download) filePath() string {
+	dir := d.options["dir"]
+	if out := d.options["out"]; out != "" {
+		return path.Join(dir, out)
+	}
+	if len(d.uris) == 0 {
+		return ""
+	}
+	return path.Join(dir, path.Base(d.uris[0]))
+}
+
+func (d *download) uriList() []map[string]string {
+	uris := make([]map[string]string, 0, len(d.uris))
+	for i, u := range d.uris {
+		status := "waiting"
+		if d.status == resp.StatusActive && i == 0 {
+			status = "used"
+		}
+		uris = append(uris, map[string]string{"uri": u, "status": status})
+	}
+	return uris
+}
+
+func (d *download) files() []map[string]any {
+	return []map[string]any{{
+		"index":           "1",
+		"path":            d.filePath(),
+		"length":          itoa(d.totalLength),
+		"completedLength": itoa(d.completedLength),
+		"selected":        "true",
+		"uris":            d.uriList(),
+	}}
+}
+
+// fields returns the download encoded the way aria2.tellStatus does, with
+// only the given keys if any.
+func (d *download) fields(keys []string) map[string]any {
+	m := map[string]any{
+		"gid":             d.gid,
+		"status":          string(d.status),
+		"totalLength":     itoa(d.totalLength),
+		"completedLength": itoa(d.completedLength),
+		"uploadLength":    itoa(d.uploadLength),
+		"downloadSpeed":   itoa(d.downloadSpeed),
+		"uploadSpeed":     itoa(d.uploadSpeed),
+		"pieceLength":     "1048576",
+		"numPieces":       itoa((d.totalLength + 1<<20 - 1) >> 20),
+		"connections":     "0",
+		"dir":             d.options["dir"],
+		"files":           d.files(),
+	}
+
+	if d.status == resp.StatusActive {
+		m["connections"] = "1"
+	}
+
+	if d.status.Stopped() {
+		m["errorCode"] = strconv.Itoa(d.errorCode)
+		if d.errorMessage != "" {
+			m["errorMessage"] = d.errorMessage
+		}
+	}
+
+	if len(d.followedBy) > 0 {
+		m["followedBy"] = d.followedBy
+	}
+	if d.following != "" {
+		m["following"] = d.following
+	}
+
+	if d.torrent {
+		m["infoHash"] = d.infoHash
+		m["numSeeders"] = "0"
+		m["seeder"] = strconv.FormatBool(d.seeder)
+		m["bittorrent"] = map[string]any{
+			"announceList": [][]string{},
+			"mode":         "single",
+			"info":         map[string]string{"name": path.Base(d.filePath())},
+		}
+	}
+
+	if len(keys) == 0 {
+		return m
+	}
+
+	filtered := make(map[string]any, len(keys))
+	for _, k := range keys {
+		if v, ok := m[k]; ok {
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
+
+// Status returns the status of a download as reported by aria2.tellStatus.
+func (s *Server) Status(gid string) (resp.Status, error) {
+	s.mu.Lock()
+	d, ok := s.downloads[gid]
+	var fields map[string]any
+	if ok {
+		fields = d.fields(nil)
+	}
+	s.mu.Unlock()
+
+	var status resp.Status
+	if !ok {
+		return status, errNotFound(gid)
+	}
+
+	err := json.Unmarshal(encode(fields), &status)
+	return status, err
+}
+
+// SetTotalLength sets the total length of a download.
+func (s *Server) SetTotalLength(gid string, n int64) error {
+	return s.update(gid, func(d *download) error {
+		d.totalLength = n
+		return nil
+	})
+}
+
+// Progress sets the completed length and the download speed of an active
+// download. The download is not completed when completed reaches its total
+// length, use Complete for that.
+func (s *Server) Progress(gid string, completed, speed int64) error {
+	return s.update(gid, func(d *download) error {
+		if d.status != resp.StatusActive {
+			return fmt.Errorf("GID#%s is not active", gid)
+		}
+		d.completedLength = min(completed, d.totalLength)
+		d.downloadSpeed = speed
+		return nil
+	})
+}
+
+// Complete finishes an active download. A BitTorrent download first becomes a
+// seeder and emits onBtDownloadComplete, calling Complete again stops seeding.
+func (s *Server) Complete(gid string) error {
+	return s.update(gid, func(d *download) error {
+		if d.status != resp.StatusActive {
+			return fmt.Errorf("GID#%s is not active", gid)
+		}
+
+		d.completedLength = d.totalLength
+		d.downloadSpeed = 0
+
+		if d.torrent && !d.seeder {
+			d.seeder = true
+			s.emitLocked(OnBtDownloadComplete, gid)
+			return nil
+		}
+
+		s.stopLocked(d, resp.StatusComplete)
+		s.emitLocked(OnDownloadComplete, gid)
+		return nil
+	})
+}
+
+// Follow adds a download generated by the download gid, as aria2 does for the
+// content of a magnet link or a .torrent downloaded over HTTP. It is listed in
+// the followedBy key of gid and returns its GID.
+func (s *Server) Follow(gid string, uris ...string) (string, error) {
+	s.mu.Lock()
+	parent, ok := s.downloads[gid]
+	if !ok {
+		s.mu.Unlock()
+		return "", errNotFound(gid)
+	}
+
+	d, err := s.addLocked(uris, map[string]string{"dir": parent.options["dir"]})
+	if err != nil {
+		s.mu.Unlock()
+		return "", err
+	}
+	d.following = gid
+	parent.followedBy = append(parent.followedBy, d.gid)
+
+	s.scheduleLocked()
+	s.mu.Unlock()
+
+	s.flush()
+	return d.gid, nil
+}
+
+// Fail stops a download with the given aria2 error code and message.
+func (s *Server) Fail(gid string, code int, message string) error {
+	return s.update(gid, func(d *download) error {
+		if d.status.Stopped() {
+			return fmt.Errorf("GID#%s is already stopped", gid)
+		}
+
+		d.errorCode = code
+		d.errorMessage = message
+		d.downloadSpeed = 0
+		s.stopLocked(d, resp.StatusError)
+		s.emitLocked(OnDownloadError, gid)
+		return nil
+	})
+}
+
+func (s *Server) update(gid string, fn func(d *download) error) error {
+	s.mu.Lock()
+	d, ok := s.downloads[gid]
+	if !ok {
+		s.mu.Unlock()
+		return errNotFound(gid)
+	}
+
+	err := fn(d)
+	s.scheduleLocked()
+	s.mu.Unlock()
+
+	s.flush()
+	return err
+}
+
+func (s *Server) addLocked(uris []string, options map[string]string) (*download, error) {
+	gid := options["gid"]
+	if gid == "" {
+		gid = randomHex(8)
+	} else if !validGID(gid) {
+		return nil, fmt.Errorf("%s is invalid for GID.", gid)
+	} else if _, ok := s.downloads[gid]; ok {
+		return nil, fmt.Errorf("GID %s is not unique.", gid)
+	}
+
+	opts := make(map[string]string, len(options)+1)
+	opts["dir"] = s.global["dir"]
+	for k, v := range options {
+		opts[k] = v
+	}
+
+	d := &download{
+		gid:     gid,
+		status:  resp.StatusWaiting,
+		uris:    uris,
+		options: opts,
+	}
+	if opts["pause"] == "true" {
+		d.status = resp.StatusPaused
+	}
+
+	s.downloads[gid] = d
+	s.waiting = append(s.waiting, gid)
+	return d, nil
+}
+
+// scheduleLocked starts waiting downloads while there are free slots.
+func (s *Server) scheduleLocked() {
+	max, _ := strconv.Atoi(s.global["max-concurrent-downloads"])
+
+	for i := 0; i < len(s.waiting) && len(s.active) < max; {
+		d := s.downloads[s.waiting[i]]
+		if d.status != resp.StatusWaiting {
+			i++
+			continue
+		}
+
+		s.waiting = slices.Delete(s.waiting, i, i+1)
+		s.active = append(s.active, d.gid)
+		d.status = resp.StatusActive
+		if d.totalLength == 0 {
+			d.totalLength = s.totalLength
+		}
+		s.emitLocked(OnDownloadStart, d.gid)
+	}
+}
+
+func (s *Server) stopLocked(d *download, status resp.DownloadStatus) {
+	s.active = remove(s.active, d.gid)
+	s.waiting = remove(s.waiting, d.gid)
+	s.stopped = append(s.stopped, d.gid)
+	d.status = status
+	d.downloadSpeed = 0
+	d.uploadSpeed = 0
+}
+
+func remove(list []string, gid string) []string {
+	if i := slices.Index(list, gid); i >= 0 {
+		return slices.Delete(list, i, i+1)
+	}
+	return list
+}
+
+func validGID(gid string) bool {
+	if len(gid) != 16 {
+		return false
+	}
+	for _, c := range gid {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func errNotFound(gid string) error {
+	return fmt.Errorf("GID %s is not found", gid)
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,643 @@
+package ariotest
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kahosan/aria2-rpc/resp"
+)
+
+type method func(s *Server, p params) (any, error)
+
+var methods map[string]method
+
+func init() {
+	methods = map[string]method{
+		"aria2.addUri":               (*Server).addURI,
+		"aria2.addTorrent":           (*Server).addTorrent,
+		"aria2.addMetalink":          (*Server).addMetalink,
+		"aria2.remove":               (*Server).remove,
+		"aria2.forceRemove":          (*Server).remove,
+		"aria2.pause":                (*Server).pause,
+		"aria2.pauseAll":             (*Server).pauseAll,
+		"aria2.forcePause":           (*Server).pause,
+		"aria2.forcePauseAll":        (*Server).pauseAll,
+		"aria2.unpause":              (*Server).unpause,
+		"aria2.unpauseAll":           (*Server).unpauseAll,
+		"aria2.tellStatus":           (*Server).tellStatus,
+		"aria2.getUris":              (*Server).getURIs,
+		"aria2.getFiles":             (*Server).getFiles,
+		"aria2.getPeers":             (*Server).getPeers,
+		"aria2.getServers":           (*Server).getServers,
+		"aria2.tellActive":           (*Server).tellActive,
+		"aria2.tellWaiting":          (*Server).tellWaiting,
+		"aria2.tellStopped":          (*Server).tellStopped,
+		"aria2.changePosition":       (*Server).changePosition,
+		"aria2.changeUri":            (*Server).changeURI,
+		"aria2.getOption":            (*Server).getOption,
+		"aria2.changeOption":         (*Server).changeOption,
+		"aria2.getGlobalOption":      (*Server).getGlobalOption,
+		"aria2.changeGlobalOption":   (*Server).changeGlobalOption,
+		"aria2.getGlobalStat":        (*Server).getGlobalStat,
+		"aria2.purgeDownloadResult":  (*Server).purgeDownloadResult,
+		"aria2.removeDownloadResult": (*Server).removeDownloadResult,
+		"aria2.getVersion":           (*Server).getVersion,
+		"aria2.getSessionInfo":       (*Server).getSessionInfo,
+		"aria2.shutdown":             (*Server).ok,
+		"aria2.forceShutdown":        (*Server).ok,
+		"aria2.saveSession":          (*Server).ok,
+		"system.multicall":           (*Server).multicall,
+		"system.listMethods":         (*Server).listMethods,
+		"system.listNotifications":   (*Server).listNotifications,
+	}
+}
+
+func defaultGlobalOptions() map[string]string {
+	return map[string]string{
+		"dir":                       "/downloads",
+		"max-concurrent-downloads":  "5",
+		"max-connection-per-server": "1",
+		"split":                     "5",
+		"continue":                  "false",
+		"file-allocation":           "prealloc",
+		"log-level":                 "debug",
+	}
+}
+
+// dispatchLocked authorizes and runs an aria2 method.
+func (s *Server) dispatchLocked(name string, raw []json.RawMessage) (any, error) {
+	fn, ok := methods[name]
+	if !ok {
+		return nil, errMethodNotFound
+	}
+
+	p := params(raw)
+
+	// as in aria2, the system methods are not authorized and keep the token
+	// in their parameters.
+	if !strings.HasPrefix(name, "system.") {
+		var token string
+		if len(p) > 0 {
+			var t string
+			if json.Unmarshal(p[0], &t) == nil && strings.HasPrefix(t, "token:") {
+				token = strings.TrimPrefix(t, "token:")
+				p = p[1:]
+			}
+		}
+
+		if s.secret != "" && token != s.secret {
+			return nil, errUnauthorized
+		}
+	}
+
+	result, err := fn(s, p)
+	if err != nil {
+		return nil, err
+	}
+
+	s.scheduleLocked()
+	return result, nil
+}
+
+type params []json.RawMessage
+
+func (p params) decode(i int, v any) error {
+	if i >= len(p) {
+		return fmt.Errorf("The parameter at %d is required but missing.", i)
+	}
+	if err := json.Unmarshal(p[i], v); err != nil {
+		return fmt.Errorf("The parameter at %d has wrong type.", i)
+	}
+	return nil
+}
+
+func (p params) optional(i int, v any) error {
+	if i >= len(p) {
+		return nil
+	}
+	return p.decode(i, v)
+}
+
+func (p params) options(i int) (map[string]string, error) {
+	var raw map[string]any
+	if err := p.optional(i, &raw); err != nil {
+		return nil, err
+	}
+
+	opts := make(map[string]string, len(raw))
+	for k, v := range raw {
+		switch v := v.(type) {
+		case string:
+			opts[k] = v
+		case []any:
+			vs := make([]string, 0, len(v))
+			for _, e := range v {
+				vs = append(vs, fmt.Sprint(e))
+			}
+			opts[k] = strings.Join(vs, "\n")
+		default:
+			opts[k] = fmt.Sprint(v)
+		}
+	}
+	return opts, nil
+}
+
+func (s *Server) download(p params, i int) (*download, error) {
+	var gid string
+	if err := p.decode(i, &gid); err != nil {
+		return nil, err
+	}
+	if !validGID(gid) {
+		return nil, fmt.Errorf("Invalid GID %s", gid)
+	}
+
+	d, ok := s.downloads[gid]
+	if !ok {
+		return nil, errNotFound(gid)
+	}
+	return d, nil
+}
+
+func (s *Server) addURI(p params) (any, error) {
+	var uris []string
+	if err := p.decode(0, &uris); err != nil {
+		return nil, err
+	}
+	if len(uris) == 0 {
+		return nil, fmt.Errorf("No URI to download.")
+	}
+
+	opts, err := p.options(1)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := s.addLocked(uris, opts)
+	if err != nil {
+		return nil, err
+	}
+	return d.gid, nil
+}
+
+func (s *Server) addTorrent(p params) (any, error) {
+	var torrent string
+	if err := p.decode(0, &torrent); err != nil {
+		return nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(torrent)
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("Bad torrent data.")
+	}
+
+	var uris []string
+	if err := p.optional(1, &uris); err != nil {
+		return nil, err
+	}
+
+	opts, err := p.options(2)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum(data)
+	d, err := s.addLocked(uris, opts)
+	if err != nil {
+		return nil, err
+	}
+	d.torrent = true
+	d.infoHash = hex.EncodeToString(sum[:])
+	return d.gid, nil
+}
+
+func (s *Server) addMetalink(p params) (any, error) {
+	var metalink string
+	if err := p.decode(0, &metalink); err != nil {
+		return nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(metalink)
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("Bad metalink data.")
+	}
+
+	opts, err := p.options(1)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := s.addLocked(nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	return []string{d.gid}, nil
+}
+
+func (s *Server) remove(p params) (any, error) {
+	d, err := s.download(p, 0)
+	if err != nil {
+		return nil, err
+	}
+	if d.status.Stopped() {
+		return nil, fmt.Errorf("Active Download not found for GID#%s", d.gid)
+	}
+
+	s.stopLocked(d, resp.StatusRemoved)
+	s.emitLocked(OnDownloadStop, d.gid)
+	return d.gid, nil
+}
+
+func (s *Server) pauseLocked(d *download) bool {
+	if d.status != resp.StatusActive && d.status != resp.StatusWaiting {
+		return false
+	}
+
+	if d.status == resp.StatusActive {
+		s.active = remove(s.active, d.gid)
+		s.waiting = append([]string{d.gid}, s.waiting...)
+	}
+	d.status = resp.StatusPaused
+	d.downloadSpeed = 0
+	s.emitLocked(OnDownloadPause, d.gid)
+	return true
+}
+
+func (s *Server) pause(p params) (any, error) {
+	d, err := s.download(p, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !s.pauseLocked(d) {
+		return nil, fmt.Errorf("GID#%s cannot be paused now", d.gid)
+	}
+	return d.gid, nil
+}
+
+func (s *Server) pauseAll(params) (any, error) {
+	for _, gid := range slices.Concat(s.active, s.waiting) {
+		s.pauseLocked(s.downloads[gid])
+	}
+	return "OK", nil
+}
+
+func (s *Server) unpause(p params) (any, error) {
+	d, err := s.download(p, 0)
+	if err != nil {
+		return nil, err
+	}
+	if d.status != resp.StatusPaused {
+		return nil, fmt.Errorf("GID#%s cannot be unpaused now", d.gid)
+	}
+
+	d.status = resp.StatusWaiting
+	return d.gid, nil
+}
+
+func (s *Server) unpauseAll(params) (any, error) {
+	for _, gid := range s.waiting {
+		if d := s.downloads[gid]; d.status == resp.StatusPaused {
+			d.status = resp.StatusWaiting
+		}
+	}
+	return "OK", nil
+}
+
+func (s *Server) tellStatus(p params) (any, error) {
+	d, err := s.download(p, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	if err := p.optional(1, &keys); err != nil {
+		return nil, err
+	}
+	return d.fields(keys), nil
+}
+
+func (s *Server) getURIs(p params) (any, error) {
+	d, err := s.download(p, 0)
+	if err != nil {
+		return nil, err
+	}
+	return d.uriList(), nil
+}
+
+func (s *Server) getFiles(p params) (any, error) {
+	d, err := s.download(p, 0)
+	if err != nil {
+		return nil, err
+	}
+	return d.files(), nil
+}
+
+func (s *Server) getPeers(p params) (any, error) {
+	if _, err := s.download(p, 0); err != nil {
+		return nil, err
+	}
+	return []any{}, nil
+}
+
+func (s *Server) getServers(p params) (any, error) {
+	d, err := s.download(p, 0)
+	if err != nil {
+		return nil, err
+	}
+	if d.status != resp.StatusActive {
+		return nil, fmt.Errorf("No active download for GID#%s", d.gid)
+	}
+	if len(d.uris) == 0 {
+		return []any{}, nil
+	}
+
+	return []map[string]any{{
+		"index": "1",
+		"servers": []map[string]string{{
+			"uri":           d.uris[0],
+			"currentUri":    d.uris[0],
+			"downloadSpeed": itoa(d.downloadSpeed),
+		}},
+	}}, nil
+}
+
+func (s *Server) statusList(gids []string, keys []string) []map[string]any {
+	list := make([]map[string]any, 0, len(gids))
+	for _, gid := range gids {
+		list = append(list, s.downloads[gid].fields(keys))
+	}
+	return list
+}
+
+func (s *Server) tellActive(p params) (any, error) {
+	var keys []string
+	if err := p.optional(0, &keys); err != nil {
+		return nil, err
+	}
+	return s.statusList(s.active, keys), nil
+}
+
+func (s *Server) tellWaiting(p params) (any, error) {
+	return s.tellRange(p, s.waiting)
+}
+
+func (s *Server) tellStopped(p params) (any, error) {
+	return s.tellRange(p, s.stopped)
+}
+
+func (s *Server) tellRange(p params, gids []string) (any, error) {
+	var offset, num int
+	var keys []string
+	if err := p.decode(0, &offset); err != nil {
+		return nil, err
+	}
+	if err := p.decode(1, &num); err != nil {
+		return nil, err
+	}
+	if err := p.optional(2, &keys); err != nil {
+		return nil, err
+	}
+	return s.statusList(window(gids, offset, num), keys), nil
+}
+
+// window returns num elements of list starting at offset. As in aria2, a
+// negative offset counts from the end of the list and the result is in
+// reversed order.
+func window(list []string, offset, num int) []string {
+	var res []string
+	if offset >= 0 {
+		for i := offset; i < len(list) && len(res) < num; i++ {
+			res = append(res, list[i])
+		}
+		return res
+	}
+
+	for i := len(list) + offset; i >= 0 && len(res) < num; i-- {
+		if i < len(list) {
+			res = append(res, list[i])
+		}
+	}
+	return res
+}
+
+func (s *Server) changePosition(p params) (any, error) {
+	d, err := s.download(p, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var pos int
+	var how string
+	if err := p.decode(1, &pos); err != nil {
+		return nil, err
+	}
+	if err := p.decode(2, &how); err != nil {
+		return nil, err
+	}
+
+	cur := slices.Index(s.waiting, d.gid)
+	if cur < 0 {
+		return nil, fmt.Errorf("GID#%s not found in the waiting queue.", d.gid)
+	}
+
+	switch how {
+	case "POS_SET":
+	case "POS_CUR":
+		pos += cur
+	case "POS_END":
+		pos += len(s.waiting) - 1
+	default:
+		return nil, fmt.Errorf("Illegal argument.")
+	}
+	pos = max(0, min(pos, len(s.waiting)-1))
+
+	s.waiting = slices.Delete(s.waiting, cur, cur+1)
+	s.waiting = slices.Insert(s.waiting, pos, d.gid)
+	return pos, nil
+}
+
+func (s *Server) changeURI(p params) (any, error) {
+	d, err := s.download(p, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var index int
+	var del, add []string
+	if err := p.decode(1, &index); err != nil {
+		return nil, err
+	}
+	if index != 1 {
+		return nil, fmt.Errorf("fileIndex is out of range")
+	}
+	if err := p.decode(2, &del); err != nil {
+		return nil, err
+	}
+	if err := p.decode(3, &add); err != nil {
+		return nil, err
+	}
+
+	deleted := 0
+	for _, u := range del {
+		if i := slices.Index(d.uris, u); i >= 0 {
+			d.uris = slices.Delete(d.uris, i, i+1)
+			deleted++
+		}
+	}
+
+	pos := len(d.uris)
+	if err := p.optional(4, &pos); err != nil {
+		return nil, err
+	}
+	pos = max(0, min(pos, len(d.uris)))
+	d.uris = slices.Insert(d.uris, pos, add...)
+
+	return []int{deleted, len(add)}, nil
+}
+
+func (s *Server) getOption(p params) (any, error) {
+	d, err := s.download(p, 0)
+	if err != nil {
+		return nil, err
+	}
+	return d.options, nil
+}
+
+func (s *Server) changeOption(p params) (any, error) {
+	d, err := s.download(p, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := p.options(1)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range opts {
+		d.options[k] = v
+	}
+	return "OK", nil
+}
+
+func (s *Server) getGlobalOption(params) (any, error) {
+	return s.global, nil
+}
+
+func (s *Server) changeGlobalOption(p params) (any, error) {
+	opts, err := p.options(0)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range opts {
+		s.global[k] = v
+	}
+	return "OK", nil
+}
+
+func (s *Server) getGlobalStat(params) (any, error) {
+	var down, up int64
+	for _, gid := range s.active {
+		down += s.downloads[gid].downloadSpeed
+		up += s.downloads[gid].uploadSpeed
+	}
+
+	return map[string]string{
+		"downloadSpeed":   itoa(down),
+		"uploadSpeed":     itoa(up),
+		"numActive":       itoa(int64(len(s.active))),
+		"numWaiting":      itoa(int64(len(s.waiting))),
+		"numStopped":      itoa(int64(len(s.stopped))),
+		"numStoppedTotal": itoa(int64(len(s.stopped))),
+	}, nil
+}
+
+func (s *Server) purgeDownloadResult(params) (any, error) {
+	for _, gid := range s.stopped {
+		delete(s.downloads, gid)
+	}
+	s.stopped = nil
+	return "OK", nil
+}
+
+func (s *Server) removeDownloadResult(p params) (any, error) {
+	d, err := s.download(p, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !d.status.Stopped() {
+		return nil, fmt.Errorf("Could not remove download result of GID#%s", d.gid)
+	}
+
+	s.stopped = remove(s.stopped, d.gid)
+	delete(s.downloads, d.gid)
+	return "OK", nil
+}
+
+func (s *Server) getVersion(params) (any, error) {
+	return map[string]any{
+		"version":         "1.37.0",
+		"enabledFeatures": []string{"Async DNS", "BitTorrent", "GZip", "HTTPS", "Message Digest", "Metalink", "XML-RPC"},
+	}, nil
+}
+
+func (s *Server) getSessionInfo(params) (any, error) {
+	return map[string]string{"sessionId": s.sessionID}, nil
+}
+
+func (s *Server) ok(params) (any, error) {
+	return "OK", nil
+}
+
+func (s *Server) multicall(p params) (any, error) {
+	var calls []struct {
+		Name   string            `json:"methodName"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := p.decode(0, &calls); err != nil {
+		return nil, err
+	}
+
+	results := make([]any, 0, len(calls))
+	for _, c := range calls {
+		if c.Name == "system.multicall" {
+			results = append(results, &Error{Code: 1, Message: "Recursive system.multicall forbidden."})
+			continue
+		}
+
+		r, err := s.dispatchLocked(c.Name, c.Params)
+		if err != nil {
+			e, ok := err.(*Error)
+			if !ok {
+				e = &Error{Code: 1, Message: err.Error()}
+			}
+			results = append(results, e)
+			continue
+		}
+		results = append(results, []any{r})
+	}
+	return results, nil
+}
+
+func (s *Server) listMethods(params) (any, error) {
+	names := make([]string, 0, len(methods))
+	for name := range methods {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (s *Server) listNotifications(params) (any, error) {
+	return []string{
+		OnDownloadStart,
+		OnDownloadPause,
+		OnDownloadStop,
+		OnDownloadComplete,
+		OnDownloadError,
+		OnBtDownloadComplete,
+	}, nil
+}
@@ -0,0 +1,411 @@
+// Package ariotest provides an in-memory aria2 emulator for tests.
+//
+// The emulator serves the aria2 JSON-RPC interface over HTTP and WebSocket on
+// an httptest.Server. It keeps a simulated download queue, but never touches
+// the network or the file system: progress is driven by the test through
+// methods such as Progress, Complete and Fail.
+//
+//	srv := ariotest.NewServer(ariotest.WithSecret("secret"))
+//	defer srv.Close()
+//
+//	client, _ := ario.NewClient(srv.URL, "secret", true)
+//	gid, _ := client.AddURI([]string{"https://example.com/file.iso"}, nil)
+//	srv.Complete(gid)
+package ariotest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Server is an aria2 emulator listening on a local address.
+type Server struct {
+	URL   string // URL of the JSON-RPC endpoint over HTTP, e.g. http://127.0.0.1:1234/jsonrpc
+	WSURL string // URL of the JSON-RPC endpoint over WebSocket, e.g. ws://127.0.0.1:1234/jsonrpc
+
+	srv         *httptest.Server
+	secret      string
+	tls         bool
+	noWebSocket bool
+	totalLength int64
+	sessionID   string
+	upgrader    websocket.Upgrader
+
+	mu        sync.Mutex
+	downloads map[string]*download
+	active    []string // GIDs of active downloads
+	waiting   []string // GIDs of waiting and paused downloads, in queue order
+	stopped   []string // GIDs of stopped downloads, in the order they stopped
+	global    map[string]string
+	events    []notification
+	conns     map[*conn]struct{}
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithSecret makes the server require the given rpc-secret.
+func WithSecret(secret string) Option {
+	return func(s *Server) { s.secret = secret }
+}
+
+// WithTotalLength sets the total length that downloads get when they start,
+// 1MiB by default. It can be changed per download with SetTotalLength.
+func WithTotalLength(n int64) Option {
+	return func(s *Server) { s.totalLength = n }
+}
+
+// WithGlobalOption sets the initial value of a global option.
+func WithGlobalOption(key, value string) Option {
+	return func(s *Server) { s.global[key] = value }
+}
+
+// WithTLS makes the server listen with TLS, the URLs use the https and wss schemes.
+func WithTLS() Option {
+	return func(s *Server) { s.tls = true }
+}
+
+// WithoutWebSocket makes the server refuse WebSocket upgrades, as some HTTP
+// gateways do. Only WSURL clients and notifications are affected.
+func WithoutWebSocket() Option {
+	return func(s *Server) { s.noWebSocket = true }
+}
+
+// NewServer starts and returns a new Server. The caller should call Close
+// when finished, to shut it down.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		totalLength: 1 << 20,
+		sessionID:   randomHex(20),
+		downloads:   make(map[string]*download),
+		global:      defaultGlobalOptions(),
+		conns:       make(map[*conn]struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jsonrpc", s.serveHTTP)
+	s.srv = httptest.NewUnstartedServer(mux)
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.tls {
+		s.srv.StartTLS()
+	} else {
+		s.srv.Start()
+	}
+
+	s.URL = s.srv.URL + "/jsonrpc"
+	s.WSURL = "ws" + strings.TrimPrefix(s.srv.URL, "http") + "/jsonrpc"
+	return s
+}
+
+// Client returns an HTTP client configured to trust the server's certificate
+// when it was started WithTLS.
+func (s *Server) Client() *http.Client {
+	return s.srv.Client()
+}
+
+// Close closes all WebSocket connections and shuts down the server.
+func (s *Server) Close() {
+	s.CloseConnections()
+	s.srv.Close()
+}
+
+// CloseConnections closes every WebSocket connection, as if aria2 was
+// restarted or a proxy dropped them. Clients may connect again.
+func (s *Server) CloseConnections() {
+	s.mu.Lock()
+	conns := s.conns
+	s.conns = make(map[*conn]struct{})
+	s.mu.Unlock()
+
+	for c := range conns {
+		c.close()
+	}
+}
+
+// Connections returns the number of open WebSocket connections.
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// Notify sends a notification for gid to every WebSocket client.
+func (s *Server) Notify(method, gid string) {
+	s.mu.Lock()
+	s.emitLocked(method, gid)
+	s.mu.Unlock()
+	s.flush()
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		if s.noWebSocket {
+			http.Error(w, "websocket upgrades are not allowed", http.StatusForbidden)
+			return
+		}
+		s.serveWS(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reply, code := s.handle(body)
+	w.Header().Set("Content-Type", "application/json-rpc")
+	w.WriteHeader(code)
+	w.Write(reply)
+
+	s.flush()
+}
+
+func (s *Server) serveWS(w http.ResponseWriter, r *http.Request) {
+	// hold the lock until the connection is registered, so that a client
+	// does not miss notifications for calls made right after dialing.
+	s.mu.Lock()
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.mu.Unlock()
+		return
+	}
+
+	c := &conn{
+		ws:   ws,
+		send: make(chan []byte, 256),
+		done: make(chan struct{}),
+	}
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+
+	go c.writeLoop()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.close()
+	}()
+
+	for {
+		_, msg, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		reply, _ := s.handle(msg)
+		if !c.write(reply) {
+			return
+		}
+		s.flush()
+	}
+}
+
+// handle processes a single request or a batch, and returns the encoded reply
+// with the HTTP status code aria2 would use for it.
+func (s *Server) handle(body []byte) ([]byte, int) {
+	body = bytes.TrimSpace(body)
+
+	if len(body) > 0 && body[0] == '[' {
+		var reqs []request
+		if err := json.Unmarshal(body, &reqs); err != nil {
+			return encode(errorResponse(nil, errParse)), http.StatusBadRequest
+		}
+
+		rsps := make([]response, 0, len(reqs))
+		for _, req := range reqs {
+			rsps = append(rsps, s.call(req))
+		}
+		return encode(rsps), http.StatusOK
+	}
+
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return encode(errorResponse(nil, errParse)), http.StatusBadRequest
+	}
+
+	rsp := s.call(req)
+	code := http.StatusOK
+	if rsp.Error != nil {
+		switch rsp.Error.Code {
+		case errInvalidRequest.Code, errParse.Code:
+			code = http.StatusBadRequest
+		case errMethodNotFound.Code:
+			code = http.StatusNotFound
+		default:
+			code = http.StatusInternalServerError
+		}
+	}
+	return encode(rsp), code
+}
+
+func (s *Server) call(req request) response {
+	if req.Method == "" {
+		return errorResponse(req.ID, errInvalidRequest)
+	}
+
+	var params []json.RawMessage
+	if len(req.Params) > 0 && string(req.Params) != "null" {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return errorResponse(req.ID, errInvalidRequest)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.dispatchLocked(req.Method, params)
+	if err != nil {
+		return errorResponse(req.ID, err)
+	}
+
+	raw, merr := json.Marshal(result)
+	if merr != nil {
+		return errorResponse(req.ID, &Error{Code: -32603, Message: merr.Error()})
+	}
+	return response{Version: "2.0", ID: req.ID, Result: raw}
+}
+
+// flush sends the pending notifications to every WebSocket client.
+func (s *Server) flush() {
+	s.mu.Lock()
+	events := s.events
+	s.events = nil
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, ev := range events {
+		msg := encode(ev)
+		for _, c := range conns {
+			c.write(msg)
+		}
+	}
+}
+
+func (s *Server) emitLocked(method, gid string) {
+	s.events = append(s.events, notification{
+		Version: "2.0",
+		Method:  method,
+		Params:  []event{{Gid: gid}},
+	})
+}
+
+type conn struct {
+	ws   *websocket.Conn
+	send chan []byte
+	once sync.Once
+	done chan struct{}
+}
+
+func (c *conn) write(msg []byte) bool {
+	select {
+	case c.send <- msg:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+func (c *conn) writeLoop() {
+	for {
+		select {
+		case msg := <-c.send:
+			if err := c.ws.WriteMessage(websocket.TextMessage, msg); err != nil {
+				c.close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *conn) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.ws.Close()
+	})
+}
+
+type request struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+type notification struct {
+	Version string  `json:"jsonrpc"`
+	Method  string  `json:"method"`
+	Params  []event `json:"params"`
+}
+
+type event struct {
+	Gid string `json:"gid"`
+}
+
+// Error is a JSON-RPC error object returned by the server.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+var (
+	errParse          = &Error{Code: -32700, Message: "Parse error."}
+	errInvalidRequest = &Error{Code: -32600, Message: "Invalid Request."}
+	errMethodNotFound = &Error{Code: -32601, Message: "Method not found."}
+	errUnauthorized   = &Error{Code: 1, Message: "Unauthorized"}
+)
+
+func errorResponse(id json.RawMessage, err error) response {
+	e, ok := err.(*Error)
+	if !ok {
+		e = &Error{Code: 1, Message: err.Error()}
+	}
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return response{Version: "2.0", ID: id, Error: e}
+}
+
+func encode(v any) []byte {
+	b, _ := json.Marshal(v)
+	return b
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,129 @@
+package ariotest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	ario "github.com/kahosan/aria2-rpc"
+	"github.com/kahosan/aria2-rpc/ariotest"
+	"github.com/kahosan/aria2-rpc/resp"
+)
+
+func TestServer(t *testing.T) {
+	srv := ariotest.NewServer(ariotest.WithSecret("secret"), ariotest.WithTotalLength(100))
+	defer srv.Close()
+
+	t.Run("token is required", func(t *testing.T) {
+		client, err := ario.NewClient(srv.URL, "wrong", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		_, err = client.GetVersion()
+		if !errors.Is(err, ario.ErrUnauthorized) {
+			t.Fatal("expected ErrUnauthorized, got: ", err)
+		}
+	})
+
+	for _, uri := range []string{srv.URL, srv.WSURL} {
+		client, err := ario.NewClient(uri, "secret", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		t.Run("scripted download over "+uri, func(t *testing.T) {
+			gid, err := client.AddURI([]string{"https://example.com/file.iso"}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := srv.Progress(gid, 40, 10); err != nil {
+				t.Fatal(err)
+			}
+
+			status, err := client.TellStatus(gid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.Status != resp.StatusActive || status.CompletedLength != 40 || status.TotalLength != 100 {
+				t.Fatal("unexpected status: ", status)
+			}
+
+			if err := srv.Fail(gid, 3, "resource not found"); err != nil {
+				t.Fatal(err)
+			}
+
+			status, err = client.TellStatus(gid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !errors.Is(ario.StatusError(status), ario.ExitResourceNotFound) {
+				t.Fatal("unexpected status: ", status)
+			}
+		})
+
+		t.Run("queue over "+uri, func(t *testing.T) {
+			gid, err := client.AddURI([]string{"https://example.com/file.iso"}, &ario.Options{Pause: ario.Ptr(true)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			waiting, err := client.TellWaiting(0, 10, "gid", "status")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(waiting) == 0 || waiting[len(waiting)-1].Gid != gid || waiting[len(waiting)-1].Status != resp.StatusPaused {
+				t.Fatal("unexpected waiting list: ", waiting)
+			}
+
+			if err := client.Unpause(gid); err != nil {
+				t.Fatal(err)
+			}
+			if err := srv.Complete(gid); err != nil {
+				t.Fatal(err)
+			}
+
+			stopped, err := client.TellStopped(-1, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stopped) != 1 || stopped[0].Gid != gid || stopped[0].Status != resp.StatusComplete {
+				t.Fatal("unexpected stopped list: ", stopped)
+			}
+		})
+	}
+
+	t.Run("notifications", func(t *testing.T) {
+		client, err := ario.NewClient(srv.WSURL, "secret", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		notify, err := client.NotifyListener(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer notify.Close()
+
+		gid, err := client.AddURI([]string{"https://example.com/file.iso"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if g := <-notify.Start(); g != gid {
+			t.Fatal("unexpected start: ", g)
+		}
+
+		if err := srv.Complete(gid); err != nil {
+			t.Fatal(err)
+		}
+
+		if g := <-notify.Complete(); g != gid {
+			t.Fatal("unexpected complete: ", g)
+		}
+	})
+}
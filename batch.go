@@ -0,0 +1,292 @@
+package ario
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/kahosan/aria2-rpc/internal/caller"
+	"github.com/kahosan/aria2-rpc/resp"
+)
+
+// ErrBatchNotRun is returned by Future.Get before the batch was run.
+var ErrBatchNotRun = errors.New("batch has not been run")
+
+// Batch queues calls and sends them to aria2 in a single system.multicall, or
+// in a JSON-RPC batch with RunNative. Each queued call returns a Future that
+// holds its result once the batch ran.
+//
+//	b := client.NewBatch()
+//	status := b.TellStatus(gid)
+//	files := b.GetFiles(gid)
+//	if err := b.Run(); err != nil {
+//		// handle error
+//	}
+//	s, err := status.Get()
+type Batch struct {
+	c       *Client
+	calls   []MultiCallMethod
+	results []func(raw json.RawMessage, err error)
+	invalid []error // why a call is not sent, e.g. invalid options
+}
+
+// Future is the result of a call queued in a Batch.
+type Future[T any] struct {
+	value T
+	err   error
+}
+
+// Get returns the result of the call, or the fault reported by aria2 for it.
+func (f *Future[T]) Get() (T, error) {
+	return f.value, f.err
+}
+
+// NewBatch returns an empty batch of calls.
+func (c *Client) NewBatch() *Batch {
+	return &Batch{c: c}
+}
+
+// Len returns the number of queued calls.
+func (b *Batch) Len() int {
+	return len(b.calls)
+}
+
+// Queue adds a call of method with params to b, and returns its future result.
+// It can be used for the methods that have no helper on Batch. The token is
+// added to params when the batch runs.
+func Queue[T any](b *Batch, method string, params ...any) *Future[T] {
+	f := &Future[T]{err: ErrBatchNotRun}
+
+	b.calls = append(b.calls, MultiCallMethod{Name: method, Params: params})
+	b.results = append(b.results, func(raw json.RawMessage, err error) {
+		if err == nil && raw != nil {
+			err = json.Unmarshal(raw, &f.value)
+		}
+		f.err = err
+	})
+	b.invalid = append(b.invalid, nil)
+
+	return f
+}
+
+// queueInvalid queues a call of method that is not sent, its result is err,
+// so that the results of RunNative still line up with the calls.
+func queueInvalid[T any](b *Batch, method string, err error) *Future[T] {
+	f := Queue[T](b, method)
+	b.invalid[len(b.invalid)-1] = err
+	f.err = err
+	return f
+}
+
+// valid returns the indexes of the calls to send, and sets the result of the
+// others.
+func (b *Batch) valid() []int {
+	var valid []int
+	for i, err := range b.invalid {
+		if err != nil {
+			b.results[i](nil, err)
+			continue
+		}
+		valid = append(valid, i)
+	}
+	return valid
+}
+
+// Run sends the queued calls. The error is only about the batch as a whole,
+// the faults of the calls are reported by their futures.
+func (b *Batch) Run() error {
+	return b.RunContext(context.Background())
+}
+
+func (b *Batch) RunContext(ctx context.Context) error {
+	valid := b.valid()
+	if len(valid) == 0 {
+		return nil
+	}
+
+	calls := make([]MultiCallMethod, len(valid))
+	for i, j := range valid {
+		calls[i] = b.calls[j]
+	}
+
+	var results []json.RawMessage
+	if err := b.c.Call(ctx, method.Multicall, []any{b.c.withToken(calls)}, &results); err != nil {
+		for _, j := range valid {
+			b.results[j](nil, err)
+		}
+		return err
+	}
+
+	if len(results) != len(calls) {
+		err := fmt.Errorf("%s: got %d results for %d calls", method.Multicall, len(results), len(calls))
+		for _, j := range valid {
+			b.results[j](nil, err)
+		}
+		return err
+	}
+
+	for i, raw := range results {
+		b.results[valid[i]](multicallResult(calls[i].Name, raw))
+	}
+	return nil
+}
+
+// RunNative sends the queued calls as a JSON-RPC 2.0 batch, in which each
+// call is a request of its own. It returns the error of each call in the order
+// they were queued, which are also reported by their futures, including the
+// calls that were not sent because they were invalid. The error is only about
+// the batch as a whole.
+func (b *Batch) RunNative() ([]error, error) {
+	return b.RunNativeContext(context.Background())
+}
+
+func (b *Batch) RunNativeContext(ctx context.Context) ([]error, error) {
+	if len(b.calls) == 0 {
+		return nil, nil
+	}
+
+	valid := b.valid()
+	errs := slices.Clone(b.invalid)
+	if len(valid) == 0 {
+		return errs, nil
+	}
+
+	calls := make([]MultiCallMethod, len(valid))
+	for i, j := range valid {
+		calls[i] = b.calls[j]
+	}
+	calls = b.c.withToken(calls)
+	replies := make([]json.RawMessage, len(calls))
+	specs := make([]caller.Spec, len(calls))
+	for i, call := range calls {
+		specs[i] = caller.Spec{Method: call.Name, Params: call.Params, Reply: &replies[i]}
+	}
+
+	sent, err := b.c.batch(ctx, specs)
+	if err != nil {
+		for _, j := range valid {
+			b.results[j](nil, err)
+		}
+		return nil, err
+	}
+
+	for i, j := range valid {
+		b.results[j](replies[i], sent[i])
+		errs[j] = sent[i]
+	}
+	return errs, nil
+}
+
+// multicallResult returns the result of a call from its system.multicall
+// entry, which is either a single-element array holding the result or a fault.
+func multicallResult(name string, raw json.RawMessage) (json.RawMessage, error) {
+	var result []json.RawMessage
+	if err := json.Unmarshal(raw, &result); err == nil {
+		if len(result) != 1 {
+			return nil, fmt.Errorf("%s: unexpected multicall result %s", name, raw)
+		}
+		return result[0], nil
+	}
+
+	var fault jrpc2.Error
+	if err := json.Unmarshal(raw, &fault); err != nil {
+		return nil, fmt.Errorf("%s: unexpected multicall result %s", name, raw)
+	}
+	return nil, toRPCError(name, &fault)
+}
+
+// withToken returns calls with the token prepended to the params of each one.
+// aria2 authorizes the nested calls of system.multicall, but not the system
+// methods themselves, which must not be given the token.
+func (c *Client) withToken(calls []MultiCallMethod) []MultiCallMethod {
+	out := make([]MultiCallMethod, len(calls))
+	for i, call := range calls {
+		out[i] = call
+		if !strings.HasPrefix(call.Name, "system.") {
+			out[i].Params = c.makeParams(call.Params...)
+		}
+	}
+	return out
+}
+
+func (b *Batch) AddURI(uris []string, options *Options) *Future[string] {
+	if err := options.validate(); err != nil {
+		return queueInvalid[string](b, method.AddURI, err)
+	}
+	return Queue[string](b, method.AddURI, uris, options)
+}
+
+func (b *Batch) Remove(gid string) *Future[string] {
+	return Queue[string](b, method.Remove, gid)
+}
+
+func (b *Batch) ForceRemove(gid string) *Future[string] {
+	return Queue[string](b, method.ForceRemove, gid)
+}
+
+func (b *Batch) Pause(gid string) *Future[string] {
+	return Queue[string](b, method.Pause, gid)
+}
+
+func (b *Batch) ForcePause(gid string) *Future[string] {
+	return Queue[string](b, method.ForcePause, gid)
+}
+
+func (b *Batch) Unpause(gid string) *Future[string] {
+	return Queue[string](b, method.Unpause, gid)
+}
+
+func (b *Batch) TellStatus(gid string, keys ...string) *Future[resp.Status] {
+	return Queue[resp.Status](b, method.TellStatus, gid, keys)
+}
+
+func (b *Batch) GetURIs(gid string) *Future[[]resp.URIs] {
+	return Queue[[]resp.URIs](b, method.GetURIs, gid)
+}
+
+func (b *Batch) GetFiles(gid string) *Future[[]resp.Files] {
+	return Queue[[]resp.Files](b, method.GetFiles, gid)
+}
+
+func (b *Batch) GetPeers(gid string) *Future[[]resp.Peers] {
+	return Queue[[]resp.Peers](b, method.GetPeers, gid)
+}
+
+func (b *Batch) GetServers(gid string) *Future[[]resp.Servers] {
+	return Queue[[]resp.Servers](b, method.GetServers, gid)
+}
+
+func (b *Batch) TellActive(keys ...string) *Future[[]resp.Status] {
+	return Queue[[]resp.Status](b, method.TellActive, keys)
+}
+
+func (b *Batch) TellWaiting(offset, num int, keys ...string) *Future[[]resp.Status] {
+	return Queue[[]resp.Status](b, method.TellWaiting, offset, num, keys)
+}
+
+func (b *Batch) TellStopped(offset, num int, keys ...string) *Future[[]resp.Status] {
+	return Queue[[]resp.Status](b, method.TellStopped, offset, num, keys)
+}
+
+func (b *Batch) GetOption(gid string) *Future[Options] {
+	return Queue[Options](b, method.GetOption, gid)
+}
+
+func (b *Batch) ChangeOption(gid string, options *Options) *Future[string] {
+	if err := options.validate(); err != nil {
+		return queueInvalid[string](b, method.ChangeOption, err)
+	}
+	return Queue[string](b, method.ChangeOption, gid, options)
+}
+
+func (b *Batch) GetGlobalStat() *Future[resp.GlobalStat] {
+	return Queue[resp.GlobalStat](b, method.GetGlobalStat)
+}
+
+func (b *Batch) GetVersion() *Future[resp.Version] {
+	return Queue[resp.Version](b, method.GetVersion)
+}
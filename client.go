@@ -4,53 +4,199 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
-	"log"
 	"net/url"
 	"reflect"
+	"sync"
 	"time"
 
 	"github.com/kahosan/aria2-rpc/internal/caller"
-	"github.com/kahosan/aria2-rpc/internal/resp"
 	"github.com/kahosan/aria2-rpc/notifier"
+	"github.com/kahosan/aria2-rpc/resp"
 )
 
 type Client struct {
-	Call           func(method string, params, reply any) error
+	Call           func(ctx context.Context, method string, params, reply any) error
 	Close          func() error
 	token          string
 	NotifyListener func(ctx context.Context) (*notifier.Notify, error)
+	onStateChange  func(fn func(caller.State)) func()
+	batch          func(ctx context.Context, specs []caller.Spec) ([]error, error)
+	logger         Logger
+
+	notifyMu sync.Mutex
+	notify   *notifier.Notify // shared by the tasks, see listener
+	closed   bool
 }
 
+// ConnState is the state of the WebSocket connection to aria2.
+type ConnState = caller.State
+
+const (
+	ConnConnected    = caller.StateConnected    // the connection is established
+	ConnDisconnected = caller.StateDisconnected // the connection was lost
+	ConnReconnecting = caller.StateReconnecting // a reconnection attempt is about to be made
+)
+
 func NewClient(host string, token string, notify bool) (*Client, error) {
+	opts := []Option{WithToken(token)}
+	if notify {
+		opts = append(opts, WithNotify())
+	}
+	return NewClientWithOptions(host, opts...)
+}
+
+// NewClientWithOptions returns a client for the aria2 at host, an http(s) or
+// ws(s) URL of its JSON-RPC endpoint, configured by opts.
+func NewClientWithOptions(host string, opts ...Option) (*Client, error) {
 	uri, err := url.Parse(host)
 	if err != nil {
 		return nil, err
 	}
 
-	c, err := caller.NewCaller(uri)
+	cfg := newConfig(opts)
+	copts, err := cfg.callerOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := caller.NewCaller(uri, copts)
 	if err != nil {
 		return nil, err
 	}
 
 	client := &Client{
-		Call:  c.Call,
-		Close: c.Close,
-		token: token,
+		Call: func(ctx context.Context, method string, params, reply any) error {
+			ctx, cancel := cfg.withTimeout(ctx)
+			defer cancel()
+			return toRPCError(method, c.Call(ctx, method, params, reply))
+		},
+		batch: func(ctx context.Context, specs []caller.Spec) ([]error, error) {
+			ctx, cancel := cfg.withTimeout(ctx)
+			defer cancel()
+
+			errs, err := c.Batch(ctx, specs)
+			for i := range errs {
+				errs[i] = toRPCError(specs[i].Method, errs[i])
+			}
+			return errs, err
+		},
+		token:         cfg.token,
+		onStateChange: c.OnStateChange,
+		logger:        cfg.logger,
 		NotifyListener: func(context.Context) (*notifier.Notify, error) {
-			return nil, fmt.Errorf("please set the notify parameter to true in the NewClient function")
+			return nil, fmt.Errorf("please set the notify parameter to true in the NewClient function, or use WithNotify")
 		},
 	}
 
-	if notify {
-		not := notifier.NewNotifier(uri)
+	client.Close = func() error {
+		client.closeListener()
+		return c.Close()
+	}
+
+	if cfg.notify {
+		not := notifier.NewPollingNotifier(client.snapshot, cfg.interval)
+		if !cfg.polling {
+			not = notifier.NewNotifier(uri, c, copts, client.snapshot).Fallback(cfg.interval)
+		}
+		not.Session(client.sessionID)
+		if cfg.enrich {
+			not.Enrich(client.TellStatusContext, cfg.statusKeys...)
+		}
 		client.NotifyListener = not.Listener
 	}
 
 	return client, nil
 }
 
+// snapshot returns the gid and status of every download, it is used by the
+// notifier to catch up with the events missed while it was disconnected, or
+// to poll aria2. The first page of each list is fetched with a single
+// system.multicall.
+func (c *Client) snapshot(ctx context.Context) ([]resp.Status, error) {
+	const page = 1000
+	keys := []string{"gid", "status", "seeder"}
+
+	b := c.NewBatch()
+	active := b.TellActive(keys...)
+	waiting := b.TellWaiting(0, page, keys...)
+	stopped := b.TellStopped(0, page, keys...)
+	if err := b.RunContext(ctx); err != nil {
+		return nil, err
+	}
+
+	list, err := active.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, q := range []struct {
+		first *Future[[]resp.Status]
+		tell  func(context.Context, int, int, ...string) ([]resp.Status, error)
+	}{
+		{waiting, c.TellWaitingContext},
+		{stopped, c.TellStoppedContext},
+	} {
+		l, err := q.first.Get()
+		for offset := page; err == nil; offset += page {
+			list = append(list, l...)
+			if len(l) < page {
+				break
+			}
+			l, err = q.tell(ctx, offset, page, keys...)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+// listener returns the Notify shared by the tasks of the client, it is
+// created on first use and closed by Close. It returns nil if notifications
+// are disabled, or could not be received.
+func (c *Client) listener() *notifier.Notify {
+	c.notifyMu.Lock()
+	defer c.notifyMu.Unlock()
+
+	if c.notify == nil && !c.closed {
+		c.notify, _ = c.NotifyListener(context.Background())
+	}
+	return c.notify
+}
+
+func (c *Client) closeListener() {
+	c.notifyMu.Lock()
+	defer c.notifyMu.Unlock()
+
+	if c.notify != nil {
+		c.notify.Close()
+	}
+	c.notify, c.closed = nil, true
+}
+
+// sessionID returns the session ID of aria2, it is set on the events of the
+// notifier.
+func (c *Client) sessionID(ctx context.Context) (string, error) {
+	info, err := c.GetSessionInfoContext(ctx)
+	return info.Id, err
+}
+
+// OnConnStateChange registers fn to be called when the state of the WebSocket
+// connection changes, and returns a function that unregisters it.
+//
+// When the connection is lost, the client reconnects with an exponential
+// backoff. Meanwhile calls wait for the connection until their context ends.
+// Read-only calls that were in flight are sent again, others fail with
+// ErrDisconnected. fn is never called for HTTP clients.
+func (c *Client) OnConnStateChange(fn func(state ConnState)) (unregister func()) {
+	return c.onStateChange(fn)
+}
+
 // only use when websocket is not supported, or if you want to use it yourself.
 // instructions for use -> https://github.com/kahosan/aria2-rpc/blob/master/client_test.go#L68
+//
+// See also NewPoller, which polls many downloads at once, with a configurable
+// interval.
 func (c *Client) StatusListenerByPolling(ctx context.Context, gid string) (status chan *resp.Status) {
 	status = make(chan *resp.Status)
 
@@ -62,12 +208,12 @@ func (c *Client) StatusListenerByPolling(ctx context.Context, gid string) (statu
 			case <-ctx.Done():
 				return
 			default:
-				s, e := c.TellStatus(gid)
+				s, e := c.TellStatusContext(ctx, gid)
 				if e != nil {
-					log.Printf("listener error: %v", e)
+					c.logger.Printf("listener error: %v", e)
 					return
 				} else if s.Gid == "" {
-					log.Println("gid not found, maybe it was removed")
+					c.logger.Printf("gid not found, maybe it was removed")
 					return
 				}
 
@@ -82,157 +228,304 @@ func (c *Client) StatusListenerByPolling(ctx context.Context, gid string) (statu
 }
 
 func (c *Client) AddURI(uris []string, options *Options) (gid string, err error) {
-	err = c.Call(method.AddURI, c.makeParams(uris, options), &gid)
+	return c.AddURIContext(context.Background(), uris, options)
+}
+
+func (c *Client) AddURIContext(ctx context.Context, uris []string, options *Options) (gid string, err error) {
+	if err = options.validate(); err != nil {
+		return
+	}
+	err = c.Call(ctx, method.AddURI, c.makeParams(uris, options), &gid)
 	return
 }
 
 func (c *Client) AddTorrent(torrent *[]byte, uris *[]string, options *Options) (gid string, err error) {
+	return c.AddTorrentContext(context.Background(), torrent, uris, options)
+}
+
+func (c *Client) AddTorrentContext(ctx context.Context, torrent *[]byte, uris *[]string, options *Options) (gid string, err error) {
+	if err = options.validate(); err != nil {
+		return
+	}
 	et := base64.StdEncoding.EncodeToString(*torrent)
-	err = c.Call(method.AddTorrent, c.makeParams(et, uris, options), &gid)
+	err = c.Call(ctx, method.AddTorrent, c.makeParams(et, uris, options), &gid)
 	return
 }
 
 func (c *Client) AddMetalink(metalink *[]byte, options *Options) (gid []string, err error) {
+	return c.AddMetalinkContext(context.Background(), metalink, options)
+}
+
+func (c *Client) AddMetalinkContext(ctx context.Context, metalink *[]byte, options *Options) (gid []string, err error) {
+	if err = options.validate(); err != nil {
+		return
+	}
 	em := base64.StdEncoding.EncodeToString(*metalink)
-	err = c.Call(method.AddMetalink, c.makeParams(em, options), &gid)
+	err = c.Call(ctx, method.AddMetalink, c.makeParams(em, options), &gid)
 	return
 }
 
 func (c *Client) Remove(gid string) error {
-	return c.Call(method.Remove, c.makeParams(gid), nil)
+	return c.RemoveContext(context.Background(), gid)
+}
+
+func (c *Client) RemoveContext(ctx context.Context, gid string) error {
+	return c.Call(ctx, method.Remove, c.makeParams(gid), nil)
 }
 
 func (c *Client) ForceRemove(gid string) error {
-	return c.Call(method.ForceRemove, c.makeParams(gid), nil)
+	return c.ForceRemoveContext(context.Background(), gid)
+}
+
+func (c *Client) ForceRemoveContext(ctx context.Context, gid string) error {
+	return c.Call(ctx, method.ForceRemove, c.makeParams(gid), nil)
 }
 
 func (c *Client) Pause(gid string) error {
-	return c.Call(method.Pause, c.makeParams(gid), nil)
+	return c.PauseContext(context.Background(), gid)
+}
+
+func (c *Client) PauseContext(ctx context.Context, gid string) error {
+	return c.Call(ctx, method.Pause, c.makeParams(gid), nil)
 }
 
 func (c *Client) PauseAll() error {
-	return c.Call(method.PauseAll, c.makeParams(), nil)
+	return c.PauseAllContext(context.Background())
+}
+
+func (c *Client) PauseAllContext(ctx context.Context) error {
+	return c.Call(ctx, method.PauseAll, c.makeParams(), nil)
 }
 
 func (c *Client) ForcePause(gid string) error {
-	return c.Call(method.ForcePause, c.makeParams(), nil)
+	return c.ForcePauseContext(context.Background(), gid)
+}
+
+func (c *Client) ForcePauseContext(ctx context.Context, gid string) error {
+	return c.Call(ctx, method.ForcePause, c.makeParams(gid), nil)
 }
 
 func (c *Client) ForcePauseAll() error {
-	return c.Call(method.ForcePauseAll, c.makeParams(), nil)
+	return c.ForcePauseAllContext(context.Background())
+}
+
+func (c *Client) ForcePauseAllContext(ctx context.Context) error {
+	return c.Call(ctx, method.ForcePauseAll, c.makeParams(), nil)
 }
 
 func (c *Client) Unpause(gid string) error {
-	return c.Call(method.Unpause, c.makeParams(gid), nil)
+	return c.UnpauseContext(context.Background(), gid)
+}
+
+func (c *Client) UnpauseContext(ctx context.Context, gid string) error {
+	return c.Call(ctx, method.Unpause, c.makeParams(gid), nil)
 }
 
 func (c *Client) UnpauseAll() error {
-	return c.Call(method.UnpauseAll, c.makeParams(), nil)
+	return c.UnpauseAllContext(context.Background())
+}
+
+func (c *Client) UnpauseAllContext(ctx context.Context) error {
+	return c.Call(ctx, method.UnpauseAll, c.makeParams(), nil)
 }
 
 func (c *Client) TellStatus(gid string, keys ...string) (status resp.Status, err error) {
-	err = c.Call(method.TellStatus, c.makeParams(gid, keys), &status)
+	return c.TellStatusContext(context.Background(), gid, keys...)
+}
+
+func (c *Client) TellStatusContext(ctx context.Context, gid string, keys ...string) (status resp.Status, err error) {
+	err = c.Call(ctx, method.TellStatus, c.makeParams(gid, keys), &status)
 	return
 }
 
 func (c *Client) GetURIs(gid string) (uris []resp.URIs, err error) {
-	err = c.Call(method.GetURIs, c.makeParams(gid), &uris)
+	return c.GetURIsContext(context.Background(), gid)
+}
+
+func (c *Client) GetURIsContext(ctx context.Context, gid string) (uris []resp.URIs, err error) {
+	err = c.Call(ctx, method.GetURIs, c.makeParams(gid), &uris)
 	return
 }
 
 func (c *Client) GetFiles(gid string) (files []resp.Files, err error) {
-	err = c.Call(method.GetFiles, c.makeParams(gid), &files)
+	return c.GetFilesContext(context.Background(), gid)
+}
+
+func (c *Client) GetFilesContext(ctx context.Context, gid string) (files []resp.Files, err error) {
+	err = c.Call(ctx, method.GetFiles, c.makeParams(gid), &files)
 	return
 }
 
 func (c *Client) GetPeers(gid string) (peers []resp.Peers, err error) {
-	err = c.Call(method.GetPeers, c.makeParams(gid), &peers)
+	return c.GetPeersContext(context.Background(), gid)
+}
+
+func (c *Client) GetPeersContext(ctx context.Context, gid string) (peers []resp.Peers, err error) {
+	err = c.Call(ctx, method.GetPeers, c.makeParams(gid), &peers)
 	return
 }
 
 func (c *Client) GetServers(gid string) (servers []resp.Servers, err error) {
-	err = c.Call(method.GetServers, c.makeParams(gid), &servers)
+	return c.GetServersContext(context.Background(), gid)
+}
+
+func (c *Client) GetServersContext(ctx context.Context, gid string) (servers []resp.Servers, err error) {
+	err = c.Call(ctx, method.GetServers, c.makeParams(gid), &servers)
 	return
 }
 
 func (c *Client) TellActive(keys ...string) (active []resp.Status, err error) {
-	err = c.Call(method.TellActive, c.makeParams(keys), &active)
+	return c.TellActiveContext(context.Background(), keys...)
+}
+
+func (c *Client) TellActiveContext(ctx context.Context, keys ...string) (active []resp.Status, err error) {
+	err = c.Call(ctx, method.TellActive, c.makeParams(keys), &active)
 	return
 }
 
 func (c *Client) TellWaiting(offset, num int, keys ...string) (waiting []resp.Status, err error) {
-	err = c.Call(method.TellWaiting, c.makeParams(offset, num, keys), &waiting)
+	return c.TellWaitingContext(context.Background(), offset, num, keys...)
+}
+
+func (c *Client) TellWaitingContext(ctx context.Context, offset, num int, keys ...string) (waiting []resp.Status, err error) {
+	err = c.Call(ctx, method.TellWaiting, c.makeParams(offset, num, keys), &waiting)
 	return
 }
 
 func (c *Client) TellStopped(offset, num int, keys ...string) (stopped []resp.Status, err error) {
-	err = c.Call(method.TellStopped, c.makeParams(offset, num, keys), &stopped)
+	return c.TellStoppedContext(context.Background(), offset, num, keys...)
+}
+
+func (c *Client) TellStoppedContext(ctx context.Context, offset, num int, keys ...string) (stopped []resp.Status, err error) {
+	err = c.Call(ctx, method.TellStopped, c.makeParams(offset, num, keys), &stopped)
 	return
 }
 
 func (c *Client) ChangePosition(gid string, pos int, how string) (err error) {
-	err = c.Call(method.ChangePosition, c.makeParams(gid, pos, how), nil)
+	return c.ChangePositionContext(context.Background(), gid, pos, how)
+}
+
+func (c *Client) ChangePositionContext(ctx context.Context, gid string, pos int, how string) (err error) {
+	err = c.Call(ctx, method.ChangePosition, c.makeParams(gid, pos, how), nil)
 	return
 }
 
 func (c *Client) ChangeURI(gid string, fileIndex int, delURIs, addURIs *[]string, position ...int) (err error) {
-	err = c.Call(method.ChangeURI, c.makeParams(gid, fileIndex, delURIs, addURIs, position), nil)
+	return c.ChangeURIContext(context.Background(), gid, fileIndex, delURIs, addURIs, position...)
+}
+
+func (c *Client) ChangeURIContext(ctx context.Context, gid string, fileIndex int, delURIs, addURIs *[]string, position ...int) (err error) {
+	err = c.Call(ctx, method.ChangeURI, c.makeParams(gid, fileIndex, delURIs, addURIs, position), nil)
 	return
 }
 
 func (c *Client) GetOption(gid string) (options Options, err error) {
-	err = c.Call(method.GetOption, c.makeParams(gid), &options)
+	return c.GetOptionContext(context.Background(), gid)
+}
+
+func (c *Client) GetOptionContext(ctx context.Context, gid string) (options Options, err error) {
+	err = c.Call(ctx, method.GetOption, c.makeParams(gid), &options)
 	return
 }
 
 func (c *Client) ChangeOption(gid string, options *Options) (err error) {
-	err = c.Call(method.ChangeOption, c.makeParams(gid, options), nil)
+	return c.ChangeOptionContext(context.Background(), gid, options)
+}
+
+func (c *Client) ChangeOptionContext(ctx context.Context, gid string, options *Options) (err error) {
+	if err = options.validate(); err != nil {
+		return
+	}
+	err = c.Call(ctx, method.ChangeOption, c.makeParams(gid, options), nil)
 	return
 }
 
-func (c *Client) GetGlobalOption() (options Options, err error) {
-	err = c.Call(method.GetGlobalOption, c.makeParams(), &options)
+func (c *Client) GetGlobalOption() (options GlobalOptions, err error) {
+	return c.GetGlobalOptionContext(context.Background())
+}
+
+func (c *Client) GetGlobalOptionContext(ctx context.Context) (options GlobalOptions, err error) {
+	err = c.Call(ctx, method.GetGlobalOption, c.makeParams(), &options)
 	return
 }
 
-func (c *Client) ChangeGlobalOption(options *Options) (err error) {
-	err = c.Call(method.ChangeGlobalOption, c.makeParams(options), nil)
+func (c *Client) ChangeGlobalOption(options *GlobalOptions) (err error) {
+	return c.ChangeGlobalOptionContext(context.Background(), options)
+}
+
+func (c *Client) ChangeGlobalOptionContext(ctx context.Context, options *GlobalOptions) (err error) {
+	if err = options.validate(); err != nil {
+		return
+	}
+	err = c.Call(ctx, method.ChangeGlobalOption, c.makeParams(options), nil)
 	return
 }
 
 func (c *Client) GetGlobalStat() (stat resp.GlobalStat, err error) {
-	err = c.Call(method.GetGlobalStat, c.makeParams(), &stat)
+	return c.GetGlobalStatContext(context.Background())
+}
+
+func (c *Client) GetGlobalStatContext(ctx context.Context) (stat resp.GlobalStat, err error) {
+	err = c.Call(ctx, method.GetGlobalStat, c.makeParams(), &stat)
 	return
 }
 
 func (c *Client) PurgeDownloadResult() error {
-	return c.Call(method.PurgeDownloadResult, c.makeParams(), nil)
+	return c.PurgeDownloadResultContext(context.Background())
+}
+
+func (c *Client) PurgeDownloadResultContext(ctx context.Context) error {
+	return c.Call(ctx, method.PurgeDownloadResult, c.makeParams(), nil)
 }
 
 func (c *Client) RemoveDownloadResult(gid string) error {
-	return c.Call(method.RemoveDownloadResult, c.makeParams(gid), nil)
+	return c.RemoveDownloadResultContext(context.Background(), gid)
+}
+
+func (c *Client) RemoveDownloadResultContext(ctx context.Context, gid string) error {
+	return c.Call(ctx, method.RemoveDownloadResult, c.makeParams(gid), nil)
 }
 
 func (c *Client) GetVersion() (version resp.Version, err error) {
-	err = c.Call(method.GetVersion, c.makeParams(), &version)
+	return c.GetVersionContext(context.Background())
+}
+
+func (c *Client) GetVersionContext(ctx context.Context) (version resp.Version, err error) {
+	err = c.Call(ctx, method.GetVersion, c.makeParams(), &version)
 	return
 }
 
 func (c *Client) GetSessionInfo() (session resp.SessionInfo, err error) {
-	err = c.Call(method.GetSessionInfo, c.makeParams(), &session)
+	return c.GetSessionInfoContext(context.Background())
+}
+
+func (c *Client) GetSessionInfoContext(ctx context.Context) (session resp.SessionInfo, err error) {
+	err = c.Call(ctx, method.GetSessionInfo, c.makeParams(), &session)
 	return
 }
 
 func (c *Client) Shutdown() error {
-	return c.Call(method.Shutdown, c.makeParams(), nil)
+	return c.ShutdownContext(context.Background())
+}
+
+func (c *Client) ShutdownContext(ctx context.Context) error {
+	return c.Call(ctx, method.Shutdown, c.makeParams(), nil)
 }
 
 func (c *Client) ForceShutdown() error {
-	return c.Call(method.ForceShutdown, c.makeParams(), nil)
+	return c.ForceShutdownContext(context.Background())
+}
+
+func (c *Client) ForceShutdownContext(ctx context.Context) error {
+	return c.Call(ctx, method.ForceShutdown, c.makeParams(), nil)
 }
 
 func (c *Client) SaveSession() error {
-	return c.Call(method.SaveSession, c.makeParams(), nil)
+	return c.SaveSessionContext(context.Background())
+}
+
+func (c *Client) SaveSessionContext(ctx context.Context) error {
+	return c.Call(ctx, method.SaveSession, c.makeParams(), nil)
 }
 
 // Method is an element of parameters used in system.multicall
@@ -241,18 +534,28 @@ type MultiCallMethod struct {
 	Params []any  `json:"params"`     // Array containing parameters to the method call
 }
 
-// if MultiCallMethod for empty method name is given, it will be ignored
+// if MultiCallMethod for empty method name is given, it will be ignored.
+// see NewBatch for typed results.
 func (c *Client) MultiCall(methods *[]MultiCallMethod) (result []any, err error) {
+	return c.MultiCallContext(context.Background(), methods)
+}
+
+func (c *Client) MultiCallContext(ctx context.Context, methods *[]MultiCallMethod) (result []any, err error) {
 	if methods == nil {
 		return nil, fmt.Errorf("invalid parameter")
 	}
 
-	err = c.Call(method.Multicall, c.makeParams(methods), &result)
+	// the token goes in the params of each call, see withToken
+	err = c.Call(ctx, method.Multicall, []any{c.withToken(*methods)}, &result)
 	return
 }
 
 func (c *Client) ListMethods() (methods []string, err error) {
-	err = c.Call(method.ListMethods, c.makeParams(), &methods)
+	return c.ListMethodsContext(context.Background())
+}
+
+func (c *Client) ListMethodsContext(ctx context.Context) (methods []string, err error) {
+	err = c.Call(ctx, method.ListMethods, c.makeParams(), &methods)
 	return
 }
 
@@ -272,6 +575,10 @@ func (c *Client) makeParams(p ...any) []any {
 			if v != nil {
 				params = append(params, v)
 			}
+		case *GlobalOptions:
+			if v != nil {
+				params = append(params, v)
+			}
 		default:
 			params = append(params, v)
 		}
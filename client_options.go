@@ -0,0 +1,173 @@
+package ario
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/kahosan/aria2-rpc/internal/caller"
+)
+
+// Option configures a Client created by NewClientWithOptions.
+type Option func(*config)
+
+// Logger records the messages of a Client, a *log.Logger can be used.
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
+type config struct {
+	token      string
+	notify     bool
+	polling    bool // poll aria2 instead of receiving its notifications
+	interval   time.Duration
+	enrich     bool
+	statusKeys []string
+	httpClient *http.Client
+	tlsConfig  *tls.Config
+	header     http.Header
+	timeout    time.Duration
+	dial       func(ctx context.Context, network, addr string) (net.Conn, error)
+	logger     Logger
+}
+
+// WithToken sets the rpc-secret of aria2.
+func WithToken(token string) Option {
+	return func(c *config) { c.token = token }
+}
+
+// WithNotify enables NotifyListener. With an http(s) host, the notifications
+// are received on a dedicated WebSocket connection, and aria2 is polled
+// instead if it cannot be established, see WithNotifyPolling.
+func WithNotify() Option {
+	return func(c *config) { c.notify = true }
+}
+
+// WithNotifyPolling enables NotifyListener, and makes it poll the downloads of
+// aria2 with system.multicall every interval instead of receiving its
+// notifications, for the gateways that do not allow WebSocket upgrades. The
+// events are the same, but only the transitions between two polls are seen.
+// The interval also applies when WithNotify falls back to polling, it is
+// notifier.DefaultPollInterval by default.
+func WithNotifyPolling(interval time.Duration) Option {
+	return func(c *config) { c.notify, c.polling, c.interval = true, true, interval }
+}
+
+// WithNotifyStatus enables NotifyListener, and attaches the given keys of the
+// status of the download, all of them if none, to the events of its Events
+// channel. The status is fetched with aria2.tellStatus right after each event.
+func WithNotifyStatus(keys ...string) Option {
+	return func(c *config) { c.notify, c.enrich, c.statusKeys = true, true, keys }
+}
+
+// WithHTTPClient sets the HTTP client used for the calls, the WebSocket
+// handshakes and the notifier. Its Timeout must be zero with a WebSocket host,
+// use WithTimeout instead.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *config) { c.httpClient = client }
+}
+
+// WithTLSConfig sets the TLS configuration of the connections, e.g. to trust
+// the self-signed certificate of aria2 with a custom RootCAs.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *config) { c.tlsConfig = cfg }
+}
+
+// WithHeader adds a header to every HTTP request and WebSocket handshake.
+func WithHeader(key, value string) Option {
+	return func(c *config) {
+		if c.header == nil {
+			c.header = make(http.Header)
+		}
+		c.header.Add(key, value)
+	}
+}
+
+// WithBasicAuth authenticates to a reverse proxy in front of aria2 with HTTP
+// basic authentication. The rpc-secret is set with WithToken.
+func WithBasicAuth(username, password string) Option {
+	auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	return WithHeader("Authorization", "Basic "+auth)
+}
+
+// WithTimeout sets the timeout of the calls whose context has no deadline.
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) { c.timeout = d }
+}
+
+// WithDialer sets the function that opens the network connections to aria2,
+// e.g. to go through a proxy or a unix socket.
+func WithDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) Option {
+	return func(c *config) { c.dial = dial }
+}
+
+// WithLogger sets the logger of the client, log.Default() by default. A nil
+// logger discards the messages.
+func WithLogger(l Logger) Option {
+	if l == nil {
+		l = nopLogger{}
+	}
+	return func(c *config) { c.logger = l }
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Printf(string, ...any) {}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{logger: log.Default()}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// withTimeout applies the default timeout to ctx if it has no deadline.
+func (c *config) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || c.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// callerOptions returns the transport configuration of the callers.
+func (c *config) callerOptions() (*caller.Options, error) {
+	client := c.httpClient
+
+	if c.tlsConfig != nil || c.dial != nil {
+		if client == nil {
+			client = &http.Client{}
+		} else {
+			cp := *client
+			client = &cp
+		}
+
+		rt := client.Transport
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+		t, ok := rt.(*http.Transport)
+		if !ok {
+			return nil, errors.New("WithTLSConfig and WithDialer need an *http.Transport in the HTTP client")
+		}
+
+		t = t.Clone()
+		if c.tlsConfig != nil {
+			t.TLSClientConfig = c.tlsConfig
+		}
+		if c.dial != nil {
+			t.DialContext = c.dial
+		}
+		client.Transport = t
+	}
+
+	return &caller.Options{
+		HTTPClient: client,
+		Header:     c.header,
+	}, nil
+}
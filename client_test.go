@@ -1,13 +1,23 @@
 package ario_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	ario "github.com/kahosan/aria2-rpc"
-	"github.com/kahosan/aria2-rpc/internal/testutils"
+	"github.com/kahosan/aria2-rpc/ariotest"
+	"github.com/kahosan/aria2-rpc/resp"
 )
 
 func TestClient(t *testing.T) {
@@ -19,8 +29,11 @@ func TestClient(t *testing.T) {
 		}
 	})
 
+	srv := ariotest.NewServer()
+	defer srv.Close()
+
 	// method test
-	client, err := ario.NewClient(testutils.Arai2Uri("https://"), "", false)
+	client, err := ario.NewClient(srv.URL, "", false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -43,7 +56,7 @@ func TestClient(t *testing.T) {
 
 	t.Run("add uri with options", func(t *testing.T) {
 		op := ario.Options{}
-		op.Dir = "/tmp"
+		op.Dir = ario.Ptr("/tmp")
 
 		// the returned value does not include storage path information
 		// manual verification is required to confirm if it has been downloaded to the specified path.
@@ -69,7 +82,7 @@ func TestClient(t *testing.T) {
 
 	t.Run("gid status listener", func(t *testing.T) {
 		op := ario.Options{}
-		op.Dir = "/tmp"
+		op.Dir = ario.Ptr("/tmp")
 		gid, err := client.AddURI([]string{"https://releases.ubuntu.com/22.04.2/ubuntu-22.04.2-live-server-amd64.iso"}, &op)
 		if err != nil {
 			t.Fatal(err)
@@ -81,15 +94,15 @@ func TestClient(t *testing.T) {
 		statusChan := client.StatusListenerByPolling(ctx, gid)
 		for v := range statusChan {
 			switch v.Status {
-			case "active":
+			case resp.StatusActive:
 				t.Log("task active")
 				pe := client.Pause(gid)
 				if pe != nil {
 					t.Fatal(pe)
 				}
-			case "waiting":
+			case resp.StatusWaiting:
 				t.Log("task waiting")
-			case "paused":
+			case resp.StatusPaused:
 				t.Log("task paused")
 
 				// if you directly delete a task while it is in pause state, aria2 will complain
@@ -103,13 +116,13 @@ func TestClient(t *testing.T) {
 					t.Fatal(re)
 				}
 
-			case "error":
+			case resp.StatusError:
 				t.Log("task error")
 				return
-			case "complete":
+			case resp.StatusComplete:
 				t.Log("task complete")
 				return
-			case "removed":
+			case resp.StatusRemoved:
 				t.Log("task removed")
 				return
 			}
@@ -167,6 +180,88 @@ func TestClient(t *testing.T) {
 		t.Log(version)
 	})
 
+	t.Run("call with canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := client.GetVersionContext(ctx)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatal("expected context.Canceled, got: ", err)
+		}
+	})
+
+	t.Run("gid not found", func(t *testing.T) {
+		_, err := client.TellStatus("0000000000000000")
+		if !errors.Is(err, ario.ErrGIDNotFound) {
+			t.Fatal("expected ErrGIDNotFound, got: ", err)
+		}
+
+		var re *ario.RPCError
+		if !errors.As(err, &re) || re.Method != "aria2.tellStatus" {
+			t.Fatal("expected *RPCError, got: ", err)
+		}
+	})
+
+	t.Run("invalid option faults", func(t *testing.T) {
+		fault := func(message string) error {
+			t.Helper()
+			hc := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				var req struct {
+					ID json.RawMessage `json:"id"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					return nil, err
+				}
+				body, err := json.Marshal(map[string]any{
+					"jsonrpc": "2.0",
+					"id":      req.ID,
+					"error":   map[string]any{"code": 1, "message": message},
+				})
+				if err != nil {
+					return nil, err
+				}
+				return &http.Response{
+					StatusCode: http.StatusBadRequest,
+					Header:     http.Header{"Content-Type": {"application/json-rpc"}},
+					Body:       io.NopCloser(bytes.NewReader(body)),
+					Request:    r,
+				}, nil
+			})}
+
+			c, err := ario.NewClientWithOptions("http://localhost:6800/jsonrpc", ario.WithHTTPClient(hc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			_, err = c.GetVersion()
+			var re *ario.RPCError
+			if !errors.As(err, &re) || re.Message != message {
+				t.Fatal("expected *RPCError, got: ", err)
+			}
+			return err
+		}
+
+		for _, msg := range []string{
+			"We encountered a problem while processing the option '--split'.",
+			"max-connection-per-server is not a valid option.",
+			"No such option: foo",
+			"Option 'dir' is invalid.",
+		} {
+			if err := fault(msg); !errors.Is(err, ario.ErrInvalidOption) {
+				t.Fatal("expected ErrInvalidOption, got: ", err)
+			}
+		}
+		for _, msg := range []string{
+			"Failed to open the file option.txt, cause: File not found",
+			"No URI to download.",
+		} {
+			if err := fault(msg); errors.Is(err, ario.ErrInvalidOption) {
+				t.Fatal("unexpected ErrInvalidOption: ", err)
+			}
+		}
+	})
+
 	t.Run("get methods", func(t *testing.T) {
 		methods, err := client.ListMethods()
 		if err != nil {
@@ -177,8 +272,43 @@ func TestClient(t *testing.T) {
 	})
 }
 
+func TestDownloadError(t *testing.T) {
+	t.Run("status without error", func(t *testing.T) {
+		if err := ario.StatusError(resp.Status{Gid: "2089b05ecca3d829", ErrorCode: 0}); err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+	})
+
+	t.Run("status with error", func(t *testing.T) {
+		err := ario.StatusError(resp.Status{Gid: "2089b05ecca3d829", ErrorCode: 6, ErrorMessage: "connection reset"})
+		if !errors.Is(err, ario.ExitNetworkProblem) {
+			t.Fatal("expected ExitNetworkProblem, got: ", err)
+		}
+
+		var de *ario.DownloadError
+		if !errors.As(err, &de) || !de.Retryable() {
+			t.Fatal("network problem should be retryable")
+		}
+	})
+
+	t.Run("catalog", func(t *testing.T) {
+		for c := ario.ExitSuccess; c <= ario.ExitChecksumError; c++ {
+			if c.Name() == "" || c.Description() == "" {
+				t.Fatal("missing catalog entry for exit code ", int(c))
+			}
+		}
+
+		if ario.ExitFileAlreadyExists.Retryable() {
+			t.Fatal("file already exists should not be retryable")
+		}
+	})
+}
+
 func TestMultiCall(t *testing.T) {
-	client, err := ario.NewClient(testutils.Arai2Uri("https://"), "", false)
+	srv := ariotest.NewServer()
+	defer srv.Close()
+
+	client, err := ario.NewClient(srv.URL, "", false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -224,3 +354,866 @@ func TestMultiCall(t *testing.T) {
 		})
 	})
 }
+
+func TestClientWithOptions(t *testing.T) {
+	t.Run("token", func(t *testing.T) {
+		srv := ariotest.NewServer(ariotest.WithSecret("secret"))
+		defer srv.Close()
+
+		client, err := ario.NewClientWithOptions(srv.URL, ario.WithToken("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		if _, err := client.GetGlobalStat(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("tls config and dialer", func(t *testing.T) {
+		srv := ariotest.NewServer(ariotest.WithTLS())
+		defer srv.Close()
+
+		cfg := srv.Client().Transport.(*http.Transport).TLSClientConfig
+		var dials atomic.Int32
+		dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dials.Add(1)
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		}
+
+		for _, host := range []string{srv.URL, srv.WSURL} {
+			client, err := ario.NewClientWithOptions(host, ario.WithTLSConfig(cfg), ario.WithDialer(dial), ario.WithNotify())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := client.GetVersion(); err != nil {
+				t.Fatal(err)
+			}
+
+			notify, err := client.NotifyListener(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			notify.Close()
+			client.Close()
+		}
+
+		if dials.Load() == 0 {
+			t.Fatal("the dialer was not used")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		srv := ariotest.NewServer()
+		defer srv.Close()
+
+		client, err := ario.NewClientWithOptions(srv.URL, ario.WithTimeout(time.Nanosecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		if _, err := client.GetVersion(); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatal("expected a deadline exceeded error, got: ", err)
+		}
+	})
+
+	t.Run("nil logger", func(t *testing.T) {
+		srv := ariotest.NewServer()
+		defer srv.Close()
+
+		client, err := ario.NewClientWithOptions(srv.URL, ario.WithLogger(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		// logs the error of the missing download, then closes the channel
+		for range client.StatusListenerByPolling(context.Background(), "0000000000000000") {
+		}
+	})
+}
+
+func TestBatch(t *testing.T) {
+	srv := ariotest.NewServer(ariotest.WithSecret("secret"))
+	defer srv.Close()
+
+	client, err := ario.NewClient(srv.URL, "secret", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	t.Run("typed results", func(t *testing.T) {
+		b := client.NewBatch()
+		add1 := b.AddURI([]string{"https://example.com/a.iso"}, nil)
+		add2 := b.AddURI([]string{"https://example.com/b.iso"}, nil)
+		if err := b.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		gid1, err := add1.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		gid2, err := add2.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b = client.NewBatch()
+		status := b.TellStatus(gid1, "gid", "status")
+		files := b.GetFiles(gid2)
+		missing := b.TellStatus("0000000000000000")
+
+		if _, err := status.Get(); !errors.Is(err, ario.ErrBatchNotRun) {
+			t.Fatal("expected ErrBatchNotRun, got: ", err)
+		}
+
+		if err := b.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := status.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Gid != gid1 || s.Status != resp.StatusActive {
+			t.Fatal("unexpected status: ", s)
+		}
+
+		f, err := files.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(f) != 1 || f[0].Path != "/downloads/b.iso" {
+			t.Fatal("unexpected files: ", f)
+		}
+
+		if _, err := missing.Get(); !errors.Is(err, ario.ErrGIDNotFound) {
+			t.Fatal("expected ErrGIDNotFound, got: ", err)
+		}
+	})
+
+	t.Run("native batch", func(t *testing.T) {
+		b := client.NewBatch()
+		add := b.AddURI([]string{"https://example.com/c.iso"}, nil)
+		missing := b.Pause("0000000000000000")
+		version := b.GetVersion()
+
+		errs, err := b.RunNative()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if errs[0] != nil || errs[2] != nil {
+			t.Fatal("unexpected errors: ", errs)
+		}
+		if !errors.Is(errs[1], ario.ErrGIDNotFound) {
+			t.Fatal("expected ErrGIDNotFound, got: ", errs[1])
+		}
+
+		if gid, err := add.Get(); err != nil || gid == "" {
+			t.Fatal("add uri failed: ", err)
+		}
+		if _, err := missing.Get(); !errors.Is(err, ario.ErrGIDNotFound) {
+			t.Fatal("expected ErrGIDNotFound, got: ", err)
+		}
+		if v, err := version.Get(); err != nil || v.Version == "" {
+			t.Fatal("get version failed: ", err)
+		}
+	})
+
+	t.Run("invalid calls keep their place", func(t *testing.T) {
+		invalid := &ario.Options{Split: ario.Ptr(0)}
+
+		b := client.NewBatch()
+		add := b.AddURI([]string{"https://example.com/d.iso"}, nil)
+		bad := b.AddURI([]string{"https://example.com/e.iso"}, invalid)
+		version := b.GetVersion()
+		if b.Len() != 3 {
+			t.Fatal("unexpected length: ", b.Len())
+		}
+
+		errs, err := b.RunNative()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(errs) != 3 || errs[0] != nil || !errors.Is(errs[1], ario.ErrInvalidOption) || errs[2] != nil {
+			t.Fatal("unexpected errors: ", errs)
+		}
+		if _, err := bad.Get(); !errors.Is(err, ario.ErrInvalidOption) {
+			t.Fatal("expected ErrInvalidOption, got: ", err)
+		}
+		gid, err := add.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, err := version.Get(); err != nil || v.Version == "" {
+			t.Fatal("get version failed: ", err)
+		}
+
+		b = client.NewBatch()
+		change := b.ChangeOption(gid, invalid)
+		status := b.TellStatus(gid, "gid")
+		if err := b.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := change.Get(); !errors.Is(err, ario.ErrInvalidOption) {
+			t.Fatal("expected ErrInvalidOption, got: ", err)
+		}
+		if s, err := status.Get(); err != nil || s.Gid != gid {
+			t.Fatal("unexpected status: ", s, err)
+		}
+	})
+
+	t.Run("multicall with a token", func(t *testing.T) {
+		result, err := client.MultiCall(&[]ario.MultiCallMethod{
+			{Name: "aria2.getVersion"},
+			{Name: "system.listMethods"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range result {
+			if _, ok := r.([]any); !ok {
+				t.Fatal("unexpected result: ", r)
+			}
+		}
+	})
+}
+
+func TestOptions(t *testing.T) {
+	srv := ariotest.NewServer()
+	defer srv.Close()
+
+	client, err := ario.NewClient(srv.URL, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	t.Run("unset options are not sent, false is", func(t *testing.T) {
+		op := ario.Options{
+			Continue: ario.Ptr(false),
+			Split:    ario.Ptr(4),
+			Header:   []string{"A: 1", "B: 2"},
+			Extra:    map[string]string{"new-option": "x"},
+		}
+
+		b, err := json.Marshal(op)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := `{"continue":"false","header":["A: 1","B: 2"],"new-option":"x","split":"4"}`
+		if string(b) != want {
+			t.Fatal("unexpected encoding: ", string(b))
+		}
+	})
+
+	t.Run("decode the values returned by aria2", func(t *testing.T) {
+		var op ario.GlobalOptions
+		data := `{"dir":"/downloads","continue":"true","seed-ratio":"1.5","header":"A: 1\nB: 2","max-concurrent-downloads":"5","new-option":"x"}`
+		if err := json.Unmarshal([]byte(data), &op); err != nil {
+			t.Fatal(err)
+		}
+
+		if *op.Dir != "/downloads" || !*op.Continue || *op.SeedRatio != 1.5 || *op.MaxConcurrentDownloads != 5 {
+			t.Fatal("unexpected options: ", op)
+		}
+		if !reflect.DeepEqual(op.Header, []string{"A: 1", "B: 2"}) {
+			t.Fatal("unexpected header: ", op.Header)
+		}
+		if op.Extra["new-option"] != "x" {
+			t.Fatal("unknown option was lost: ", op.Extra)
+		}
+		if op.Split != nil {
+			t.Fatal("split should be unset")
+		}
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		var op ario.Options
+		if err := json.Unmarshal([]byte(`{"split":"many"}`), &op); err == nil {
+			t.Fatal("should error")
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		info, ok := ario.LookupOption("max-download-limit")
+		if !ok || info.Type != ario.OptionSize || !info.ActiveChangeable {
+			t.Fatal("unexpected option info: ", info)
+		}
+		if len(ario.OptionInfos()) < 180 {
+			t.Fatal("missing options")
+		}
+
+		for _, tc := range []struct {
+			options ario.Options
+			field   string
+		}{
+			{ario.Options{FileAllocation: ario.Ptr("prealoc")}, "FileAllocation"},
+			{ario.Options{Split: ario.Ptr(0)}, "Split"},
+			{ario.Options{MinSplitSize: ario.Ptr(512 * ario.KiB)}, "MinSplitSize"},
+			{ario.Options{Timeout: ario.Ptr(ario.Duration(1500 * time.Millisecond))}, "Timeout"},
+			{ario.Options{Extra: map[string]string{"max-download-limit": "10 MB/s"}}, `Extra["max-download-limit"]`},
+			{ario.Options{Extra: map[string]string{"max-concurrent-downloads": "2"}}, `Extra["max-concurrent-downloads"]`},
+		} {
+			_, err := client.AddURI([]string{"https://example.com/file.iso"}, &tc.options)
+			var oe *ario.OptionError
+			if !errors.As(err, &oe) || !errors.Is(err, ario.ErrInvalidOption) {
+				t.Fatal("expected an option error, got: ", err)
+			}
+			if oe.Field != tc.field {
+				t.Fatal("unexpected field: ", oe.Field)
+			}
+			t.Log(err)
+
+			// the same rules as the methods that send them
+			if verr := tc.options.Validate(); verr == nil || verr.Error() != err.Error() {
+				t.Fatal("unexpected validation error: ", verr)
+			}
+		}
+
+		valid := ario.Options{FileAllocation: ario.Ptr("falloc"), MinSplitSize: ario.Ptr(ario.MiB), Extra: map[string]string{"unknown-option": "x"}}
+		if err := valid.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("sizes, speeds and durations", func(t *testing.T) {
+		op := ario.Options{
+			MinSplitSize:     ario.Ptr(20 * ario.MiB),
+			MaxDownloadLimit: ario.Ptr(ario.Speed(512 * ario.KiB)),
+			Timeout:          ario.Ptr(ario.Duration(90 * time.Second)),
+			SeedTime:         ario.Ptr(ario.Duration(90 * time.Minute)),
+		}
+
+		b, err := json.Marshal(op)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := `{"max-download-limit":"512K","min-split-size":"20M","seed-time":"90","timeout":"90"}`
+		if string(b) != want {
+			t.Fatal("unexpected encoding: ", string(b))
+		}
+
+		var got ario.Options
+		if err := json.Unmarshal([]byte(`{"min-split-size":"20971520","max-download-limit":"1M","timeout":"60","seed-time":"0.5","max-mmap-limit":"9223372036854775807"}`), &got); err != nil {
+			t.Fatal(err)
+		}
+		if *got.MinSplitSize != 20*ario.MiB || *got.MaxDownloadLimit != ario.Speed(ario.MiB) ||
+			*got.Timeout != ario.Duration(time.Minute) || *got.SeedTime != ario.Duration(30*time.Second) ||
+			*got.MaxMMapLimit != math.MaxInt64 {
+			t.Fatal("unexpected options: ", got)
+		}
+
+		if s := got.MinSplitSize.String(); s != "20.0MiB" {
+			t.Fatal("unexpected size format: ", s)
+		}
+		if s := got.MaxDownloadLimit.String(); s != "1.0MiB/s" {
+			t.Fatal("unexpected speed format: ", s)
+		}
+		if s := got.SeedTime.String(); s != "30s" {
+			t.Fatal("unexpected duration format: ", s)
+		}
+
+		speed, err := ario.ParseSpeed("1.5MiB/s")
+		if err != nil || speed != ario.Speed(1536*ario.KiB) {
+			t.Fatal("unexpected speed: ", speed, err)
+		}
+		if _, err := ario.ParseByteSize("lots"); err == nil {
+			t.Fatal("should error")
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		gid, err := client.AddURI([]string{"https://example.com/file.iso"}, &ario.Options{
+			Continue: ario.Ptr(true),
+			Extra:    map[string]string{"new-option": "x"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		op, err := client.GetOption(gid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		op.Continue = ario.Ptr(false)
+		if err := client.ChangeOption(gid, &op); err != nil {
+			t.Fatal(err)
+		}
+
+		op, err = client.GetOption(gid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *op.Continue || op.Extra["new-option"] != "x" {
+			t.Fatal("unexpected options: ", op)
+		}
+
+		global, err := client.GetGlobalOption()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if global.MaxConcurrentDownloads == nil || global.LogLevel == nil {
+			t.Fatal("global options were not decoded: ", global)
+		}
+
+		if err := client.ChangeGlobalOption(&ario.GlobalOptions{MaxConcurrentDownloads: ario.Ptr(1)}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestTask(t *testing.T) {
+	srv := ariotest.NewServer()
+	defer srv.Close()
+
+	client, err := ario.NewClient(srv.URL, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	add := func(t *testing.T, c *ario.Client) *ario.Task {
+		t.Helper()
+		task, err := c.AddURITask([]string{"https://example.com/file.iso"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		task.Interval = 10 * time.Millisecond
+		return task
+	}
+
+	t.Run("wait for completion", func(t *testing.T) {
+		task := add(t, client)
+		gid := task.GIDs()[0]
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			srv.Complete(gid)
+		}()
+
+		status, err := task.Wait(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Gid != gid || status.Status != resp.StatusComplete {
+			t.Fatalf("unexpected status %+v", status)
+		}
+	})
+
+	t.Run("follow the downloads it is followed by", func(t *testing.T) {
+		task := add(t, client)
+		gid := task.GIDs()[0]
+
+		child, err := srv.Follow(gid, "https://example.com/content.iso")
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.Complete(gid)
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			srv.Complete(child)
+		}()
+
+		status, err := task.Wait(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Gid != child || status.Following != gid {
+			t.Fatalf("unexpected status %+v", status)
+		}
+		if gids := task.GIDs(); len(gids) != 1 || gids[0] != child {
+			t.Fatal("unexpected gids", gids)
+		}
+	})
+
+	t.Run("follow the downloads it is followed by with notifications", func(t *testing.T) {
+		ws, err := ario.NewClient(srv.WSURL, "", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+
+		task := add(t, ws)
+		task.Interval = time.Second // polled every 10s, the notifications wake it up
+		gid := task.GIDs()[0]
+
+		child, err := srv.Follow(gid, "https://example.com/content.iso")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			srv.Complete(gid)
+			time.Sleep(50 * time.Millisecond)
+			srv.Complete(child)
+		}()
+
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		if status, err := task.Wait(ctx); err != nil || status.Gid != child {
+			t.Fatalf("unexpected status %+v, %v", status, err)
+		}
+	})
+
+	t.Run("tasks share a listener", func(t *testing.T) {
+		c, err := ario.NewClientWithOptions(srv.URL, ario.WithNotify())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		var wg sync.WaitGroup
+		for range 3 {
+			task := add(t, c)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				task.Wait(ctx)
+			}()
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		if n := srv.Connections(); n != 1 {
+			t.Fatal("expected a single connection, got", n)
+		}
+		cancel()
+		wg.Wait()
+
+		c.Close()
+		for i := 0; srv.Connections() != 0; i++ {
+			if i == 100 {
+				t.Fatal("the listener was not closed")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("failed download", func(t *testing.T) {
+		task := add(t, client)
+		srv.Fail(task.GIDs()[0], 3, "resource not found")
+
+		_, err := task.Wait(ctx)
+		var de *ario.DownloadError
+		if !errors.As(err, &de) || !errors.Is(err, ario.ExitResourceNotFound) {
+			t.Fatal("expected a download error, got", err)
+		}
+	})
+
+	t.Run("pause, resume and cancel", func(t *testing.T) {
+		task := add(t, client)
+		gid := task.GIDs()[0]
+
+		if err := task.Pause(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if s, _ := srv.Status(gid); s.Status != resp.StatusPaused {
+			t.Fatal("download not paused", s.Status)
+		}
+
+		if err := task.Resume(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if s, _ := srv.Status(gid); s.Status == resp.StatusPaused {
+			t.Fatal("download not resumed")
+		}
+
+		if err := task.Cancel(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := task.Wait(ctx); !errors.Is(err, ario.ErrDownloadRemoved) {
+			t.Fatal("expected a removed download, got", err)
+		}
+	})
+
+	t.Run("pause, resume and cancel downloads in mixed states", func(t *testing.T) {
+		var gids []string
+		for range 3 {
+			gids = append(gids, add(t, client).GIDs()[0])
+		}
+		task := client.Task(gids...)
+
+		statuses := func() []resp.DownloadStatus {
+			var list []resp.DownloadStatus
+			for _, gid := range gids {
+				s, _ := srv.Status(gid)
+				list = append(list, s.Status)
+			}
+			return list
+		}
+
+		// one paused, one failed, one active or waiting
+		if err := client.Pause(gids[0]); err != nil {
+			t.Fatal(err)
+		}
+		srv.Fail(gids[2], 3, "resource not found")
+
+		if err := task.Resume(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if s := statuses(); s[0] == resp.StatusPaused {
+			t.Fatal("download not resumed", s)
+		}
+
+		for range 2 {
+			if err := task.Pause(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if s := statuses(); s[0] != resp.StatusPaused || s[1] != resp.StatusPaused || s[2] != resp.StatusError {
+			t.Fatal("unexpected statuses", s)
+		}
+
+		if err := task.Resume(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := task.Cancel(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if s := statuses(); s[0] != resp.StatusRemoved || s[1] != resp.StatusRemoved || s[2] != resp.StatusError {
+			t.Fatal("unexpected statuses", s)
+		}
+	})
+
+	t.Run("progress with notifications", func(t *testing.T) {
+		ws, err := ario.NewClient(srv.WSURL, "", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+
+		task := add(t, ws)
+		gid := task.GIDs()[0]
+
+		progress := task.Progress(ctx)
+		if p := <-progress; p.Done || len(p.Statuses) != 1 {
+			t.Fatalf("unexpected progress %+v", p)
+		}
+
+		srv.Progress(gid, 512, 128)
+		srv.Complete(gid)
+
+		var last ario.Progress
+		for p := range progress {
+			last = p
+		}
+		if !last.Done || last.CompletedLength != last.TotalLength || last.Statuses[0].Status != resp.StatusComplete {
+			t.Fatalf("unexpected last progress %+v", last)
+		}
+	})
+
+	t.Run("progress error", func(t *testing.T) {
+		var last []ario.Progress
+		for p := range client.Task().Progress(ctx) {
+			last = append(last, p)
+		}
+		if len(last) != 1 || last[0].Err == nil || last[0].Done {
+			t.Fatalf("expected a single snapshot with an error, got %+v", last)
+		}
+	})
+
+	t.Run("progress ticks while a download is active with notifications", func(t *testing.T) {
+		ws, err := ario.NewClient(srv.WSURL, "", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+
+		task := add(t, ws)
+		gid := task.GIDs()[0]
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		progress := task.Progress(ctx)
+
+		// no notification is sent for the bytes downloaded, snapshots are
+		// still expected every Interval rather than every 10 Interval
+		var completed []int64
+		deadline := time.After(400 * time.Millisecond)
+		for i := int64(1); ; i++ {
+			srv.Progress(gid, i*10, 100)
+			select {
+			case p := <-progress:
+				completed = append(completed, p.CompletedLength)
+				continue
+			case <-deadline:
+			}
+			break
+		}
+		if len(completed) < 6 {
+			t.Fatal("too few snapshots while the download is active", completed)
+		}
+		if completed[len(completed)-1] == 0 {
+			t.Fatal("the progress did not change", completed)
+		}
+	})
+}
+
+func TestPoller(t *testing.T) {
+	srv := ariotest.NewServer()
+	defer srv.Close()
+
+	client, err := ario.NewClient(srv.URL, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+
+	var gids []string
+	for range 3 {
+		gid, err := client.AddURI([]string{"https://example.com/file.iso"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gids = append(gids, gid)
+	}
+
+	t.Run("only changes are reported", func(t *testing.T) {
+		p := client.NewPoller(ario.WithPollKeys("completedLength", "downloadSpeed"))
+		p.Add(gids...)
+
+		events, _ := p.Poll(ctx)
+		if len(events) != 3 {
+			t.Fatal("expected an event per download, got", len(events))
+		}
+		for _, e := range events {
+			if e.Err != nil || !reflect.DeepEqual(e.Changed, []string{"completedLength", "downloadSpeed", "gid", "status"}) {
+				t.Fatalf("unexpected first event %+v", e)
+			}
+		}
+
+		if events, _ := p.Poll(ctx); len(events) != 0 {
+			t.Fatal("expected no event without change, got", events)
+		}
+
+		srv.Progress(gids[1], 512, 128)
+		events, _ = p.Poll(ctx)
+		if len(events) != 1 || events[0].Gid != gids[1] || events[0].Status.CompletedLength != 512 {
+			t.Fatalf("unexpected events %+v", events)
+		}
+		if !reflect.DeepEqual(events[0].Changed, []string{"completedLength", "downloadSpeed"}) {
+			t.Fatal("unexpected changed keys", events[0].Changed)
+		}
+	})
+
+	t.Run("one multicall per tick", func(t *testing.T) {
+		var calls atomic.Int32
+		counting := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			calls.Add(1)
+			return http.DefaultTransport.RoundTrip(r)
+		})}
+		c, err := ario.NewClientWithOptions(srv.URL, ario.WithHTTPClient(counting))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		p := c.NewPoller()
+		p.Add(gids...)
+		p.Poll(ctx)
+		if calls.Load() != 1 {
+			t.Fatal("expected a single request, got", calls.Load())
+		}
+	})
+
+	t.Run("stopped and unknown downloads", func(t *testing.T) {
+		p := client.NewPoller(ario.WithPollKeys("status"))
+		p.Add(gids[0], "0000000000000001")
+		p.Poll(ctx)
+
+		srv.Complete(gids[0])
+		events, _ := p.Poll(ctx)
+		if len(events) != 1 || events[0].Status.Status != resp.StatusComplete {
+			t.Fatalf("unexpected events %+v", events)
+		}
+		if len(p.GIDs()) != 0 {
+			t.Fatal("stopped downloads are still polled", p.GIDs())
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		p := client.NewPoller()
+		p.Add("0000000000000002")
+
+		events, _ := p.Poll(ctx)
+		if len(events) != 1 || !errors.Is(events[0].Err, ario.ErrGIDNotFound) {
+			t.Fatalf("unexpected events %+v", events)
+		}
+	})
+
+	t.Run("adaptive interval", func(t *testing.T) {
+		p := client.NewPoller(ario.WithPollKeys("status"), ario.WithAdaptiveInterval(100*time.Millisecond, 10*time.Second))
+		p.Add(gids[2])
+
+		if _, next := p.Poll(ctx); next != 10*time.Second {
+			t.Fatal("expected the maximum interval without progress, got", next)
+		}
+
+		srv.SetTotalLength(gids[2], 10000)
+		srv.Progress(gids[2], 0, 5000) // 2s left
+		if _, next := p.Poll(ctx); next != 200*time.Millisecond {
+			t.Fatal("unexpected interval", next)
+		}
+
+		srv.Progress(gids[2], 9999, 5000)
+		if _, next := p.Poll(ctx); next != 100*time.Millisecond {
+			t.Fatal("expected the minimum interval, got", next)
+		}
+	})
+
+	t.Run("adaptive interval bounds", func(t *testing.T) {
+		p := client.NewPoller(ario.WithPollKeys("status"), ario.WithAdaptiveInterval(0, time.Second))
+		p.Add(gids[2])
+		srv.Progress(gids[2], 9999, 5000) // 0.2ms left
+		if _, next := p.Poll(ctx); next != ario.MinPollInterval {
+			t.Fatal("expected the minimum interval, got", next)
+		}
+
+		// max is raised to min
+		p = client.NewPoller(ario.WithPollKeys("status"), ario.WithAdaptiveInterval(0, 5*time.Millisecond))
+		p.Add(gids[0])
+		if _, next := p.Poll(ctx); next != ario.MinPollInterval {
+			t.Fatal("expected the minimum interval, got", next)
+		}
+	})
+
+	t.Run("run", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		p := client.NewPoller(ario.WithPollInterval(10 * time.Millisecond))
+		p.Add(gids[1])
+
+		events := p.Run(ctx)
+		if e := <-events; e.Gid != gids[1] {
+			t.Fatalf("unexpected event %+v", e)
+		}
+
+		srv.Progress(gids[1], 1024, 0)
+		if e := <-events; e.Status.CompletedLength != 1024 {
+			t.Fatalf("unexpected event %+v", e)
+		}
+
+		cancel()
+		for range events {
+		}
+	})
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
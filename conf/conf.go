@@ -0,0 +1,210 @@
+// Package conf reads and writes aria2.conf files, and applies them to a
+// running aria2.
+//
+// A config file has one option per line, written as name=value without the
+// leading dashes of the command line. Lines starting with # are comments, and
+// the options that can be given several times, such as header, are repeated.
+package conf
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	ario "github.com/kahosan/aria2-rpc"
+	"github.com/kahosan/aria2-rpc/internal/optfile"
+)
+
+// ParseError reports an invalid line of a config file.
+type ParseError struct {
+	Line int // 1-based
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Parse reads the options of an aria2.conf file. The values are checked like
+// the options sent to aria2, an invalid one is reported as a *ParseError that
+// wraps the *ario.OptionError. Options unknown to this package are kept in
+// Extra, the last value wins if they are repeated.
+func Parse(r io.Reader) (*ario.GlobalOptions, error) {
+	values := make(map[string][]string)
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, err := optfile.Cut(line)
+		if err != nil {
+			return nil, &ParseError{Line: n, Err: err}
+		}
+
+		// check the line on its own, so that the error has its number
+		if err := check(name, value); err != nil {
+			return nil, &ParseError{Line: n, Err: err}
+		}
+
+		optfile.Add(values, name, value)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return decode(values)
+}
+
+// ParseFile reads the options of the aria2.conf file name.
+func ParseFile(name string) (*ario.GlobalOptions, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	o, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return o, nil
+}
+
+// Write writes the options set in o in canonical form: one line per value,
+// sorted by name, with sizes, speeds and durations in the syntax of aria2.
+// Parsing the output gives back the same options.
+func Write(w io.Writer, o *ario.GlobalOptions) error {
+	values, err := optfile.Encode(o)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, name := range optfile.Names(values) {
+		for _, value := range values[name] {
+			fmt.Fprintf(bw, "%s=%s\n", name, value)
+		}
+	}
+	return bw.Flush()
+}
+
+// Change is an option whose value differs between the running aria2 and a
+// config.
+type Change struct {
+	Name string
+	Old  string // current value, "" if it is not set; lists are joined with newlines
+	New  string // value in the config
+	// Restart is true if aria2.changeGlobalOption cannot change the option,
+	// the change only takes effect once aria2 is restarted with the config.
+	Restart bool
+}
+
+// Diff returns the options set in desired whose value differs in current,
+// sorted by name. Values are compared in canonical form, so "1048576" and
+// "1M" are equal. Options that are only set in current are not reported, a
+// config file does not have to list every option.
+func Diff(current, desired *ario.GlobalOptions) ([]Change, error) {
+	cur, err := optfile.Encode(current)
+	if err != nil {
+		return nil, err
+	}
+	want, err := optfile.Encode(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for _, name := range optfile.Names(want) {
+		if slices.Equal(cur[name], want[name]) {
+			continue
+		}
+
+		info, ok := ario.LookupOption(name)
+		changes = append(changes, Change{
+			Name:    name,
+			Old:     strings.Join(cur[name], "\n"),
+			New:     strings.Join(want[name], "\n"),
+			Restart: !ok || !info.GlobalChangeable,
+		})
+	}
+	return changes, nil
+}
+
+// SyncResult is the outcome of Sync.
+type SyncResult struct {
+	Applied []Change // changed through aria2.changeGlobalOption
+	Restart []Change // left as is, they need aria2 to be restarted
+}
+
+// Sync compares desired with the global options of the aria2 behind c, and
+// applies the options that differ and can be changed at runtime in a single
+// aria2.changeGlobalOption call. The other differences are returned in
+// Restart. Nothing is sent if every option is up to date.
+func Sync(ctx context.Context, c *ario.Client, desired *ario.GlobalOptions) (*SyncResult, error) {
+	current, err := c.GetGlobalOptionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := Diff(&current, desired)
+	if err != nil {
+		return nil, err
+	}
+
+	want, err := optfile.Encode(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{}
+	apply := make(map[string][]string)
+	for _, change := range changes {
+		if change.Restart {
+			result.Restart = append(result.Restart, change)
+			continue
+		}
+		result.Applied = append(result.Applied, change)
+		apply[change.Name] = want[change.Name]
+	}
+
+	if len(apply) == 0 {
+		return result, nil
+	}
+
+	options, err := decode(apply)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.ChangeGlobalOptionContext(ctx, options); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// check reports whether value is valid for the option name.
+func check(name, value string) error {
+	o, err := decode(map[string][]string{name: {value}})
+	if err != nil {
+		return err
+	}
+	return o.Validate()
+}
+
+func decode(values map[string][]string) (*ario.GlobalOptions, error) {
+	var o ario.GlobalOptions
+	if err := optfile.Decode(values, &o); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
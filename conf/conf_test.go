@@ -0,0 +1,171 @@
+package conf_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	ario "github.com/kahosan/aria2-rpc"
+	"github.com/kahosan/aria2-rpc/ariotest"
+	"github.com/kahosan/aria2-rpc/conf"
+)
+
+const sample = `# downloads
+dir=/data/downloads
+max-concurrent-downloads = 3
+
+min-split-size=1048576
+timeout=90
+header=X-A: 1
+header=X-B: 2
+  # indented comment
+rpc-listen-port=6801
+future-option=a#b
+`
+
+func TestConf(t *testing.T) {
+
+	t.Run("parse", func(t *testing.T) {
+		o, err := conf.Parse(strings.NewReader(sample))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if *o.Dir != "/data/downloads" || *o.MaxConcurrentDownloads != 3 || *o.RPCListenPort != 6801 {
+			t.Fatal("unexpected options", *o.Dir, *o.MaxConcurrentDownloads, *o.RPCListenPort)
+		}
+		if *o.MinSplitSize != ario.MiB || *o.Timeout != ario.Duration(90*time.Second) {
+			t.Fatal("unexpected typed options", *o.MinSplitSize, *o.Timeout)
+		}
+		if !reflect.DeepEqual(o.Header, []string{"X-A: 1", "X-B: 2"}) {
+			t.Fatal("unexpected header", o.Header)
+		}
+		if o.Extra["future-option"] != "a#b" {
+			t.Fatal("unknown option not kept", o.Extra)
+		}
+		if o.Split != nil {
+			t.Fatal("unset option is set")
+		}
+	})
+
+	t.Run("parse errors", func(t *testing.T) {
+		_, err := conf.Parse(strings.NewReader("dir=/tmp\nsplit=abc\n"))
+		var pe *conf.ParseError
+		if !errors.As(err, &pe) || pe.Line != 2 {
+			t.Fatal("expected a parse error on line 2, got", err)
+		}
+
+		_, err = conf.Parse(strings.NewReader("# ok\nfile-allocation=prealoc\n"))
+		if !errors.As(err, &pe) || pe.Line != 2 || !errors.Is(err, ario.ErrInvalidOption) {
+			t.Fatal("expected an invalid option on line 2, got", err)
+		}
+		t.Log(err)
+
+		_, err = conf.Parse(strings.NewReader("dir\n"))
+		if !errors.As(err, &pe) || pe.Line != 1 {
+			t.Fatal("expected a parse error on line 1, got", err)
+		}
+	})
+
+	t.Run("write canonical form", func(t *testing.T) {
+		o, err := conf.Parse(strings.NewReader(sample))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := conf.Write(&buf, o); err != nil {
+			t.Fatal(err)
+		}
+
+		want := `dir=/data/downloads
+future-option=a#b
+header=X-A: 1
+header=X-B: 2
+max-concurrent-downloads=3
+min-split-size=1M
+rpc-listen-port=6801
+timeout=90
+`
+		if buf.String() != want {
+			t.Fatalf("unexpected output:\n%s", buf.String())
+		}
+
+		again, err := conf.Parse(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(o, again) {
+			t.Fatal("round trip changed the options")
+		}
+	})
+
+	srv := ariotest.NewServer(ariotest.WithGlobalOption("min-split-size", "1048576"))
+	defer srv.Close()
+
+	client, err := ario.NewClient(srv.URL, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	desired, err := conf.Parse(strings.NewReader("dir=/data\nmax-concurrent-downloads=5\nmin-split-size=1M\nsplit=8\nrpc-listen-port=6801\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("diff", func(t *testing.T) {
+		current, err := client.GetGlobalOption()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		changes, err := conf.Diff(&current, desired)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []conf.Change{
+			{Name: "dir", Old: "/downloads", New: "/data"},
+			{Name: "rpc-listen-port", Old: "", New: "6801", Restart: true},
+			{Name: "split", Old: "5", New: "8"},
+		}
+		if !reflect.DeepEqual(changes, want) {
+			t.Fatalf("unexpected changes %+v", changes)
+		}
+	})
+
+	t.Run("sync", func(t *testing.T) {
+		result, err := conf.Sync(context.Background(), client, desired)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result.Applied) != 2 || result.Applied[0].Name != "dir" || result.Applied[1].Name != "split" {
+			t.Fatalf("unexpected applied changes %+v", result.Applied)
+		}
+		if len(result.Restart) != 1 || result.Restart[0].Name != "rpc-listen-port" {
+			t.Fatalf("unexpected restart changes %+v", result.Restart)
+		}
+
+		current, err := client.GetGlobalOption()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *current.Dir != "/data" || *current.Split != 8 || current.RPCListenPort != nil {
+			t.Fatal("options not applied", *current.Dir, *current.Split)
+		}
+
+		result, err = conf.Sync(context.Background(), client, desired)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Applied) != 0 || len(result.Restart) != 1 {
+			t.Fatalf("unexpected changes after sync %+v", result)
+		}
+	})
+}
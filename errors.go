@@ -0,0 +1,231 @@
+package ario
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/creachadair/jrpc2"
+	"github.com/kahosan/aria2-rpc/internal/caller"
+	"github.com/kahosan/aria2-rpc/resp"
+)
+
+// Common faults reported by aria2. Errors returned by the client wrap one of
+// these when the fault is recognized, so they can be tested with errors.Is.
+var (
+	ErrUnauthorized   = errors.New("unauthorized")
+	ErrGIDNotFound    = errors.New("gid not found")
+	ErrInvalidOption  = errors.New("invalid option")
+	ErrMethodNotFound = errors.New("method not found")
+
+	// ErrDisconnected is returned for a call that was in flight when the
+	// WebSocket connection was lost, and that cannot be sent again safely.
+	ErrDisconnected = caller.ErrDisconnected
+)
+
+// RPCError represents a JSON-RPC fault returned by aria2.
+type RPCError struct {
+	Method  string // Method that was called
+	Code    int    // JSON-RPC error code, aria2 uses 1 for most of its own errors
+	Message string // Message reported by aria2
+
+	kind error
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("%s: [%d] %s", e.Method, e.Code, e.Message)
+}
+
+// Unwrap returns the common fault matching e, if any.
+func (e *RPCError) Unwrap() error {
+	return e.kind
+}
+
+// toRPCError converts a fault from the server into a *RPCError, other errors
+// (transport failures, context errors) are returned unchanged.
+func toRPCError(method string, err error) error {
+	var je *jrpc2.Error
+	if !errors.As(err, &je) {
+		return err
+	}
+
+	e := &RPCError{
+		Method:  method,
+		Code:    int(je.Code),
+		Message: je.Message,
+	}
+
+	msg := strings.ToLower(je.Message)
+	switch {
+	case je.Code == jrpc2.MethodNotFound:
+		e.kind = ErrMethodNotFound
+	case msg == "unauthorized":
+		e.kind = ErrUnauthorized
+	case strings.Contains(msg, "is not found"),
+		strings.Contains(msg, "not found for gid"),
+		strings.Contains(msg, "invalid gid"),
+		strings.Contains(msg, "no such download"):
+		e.kind = ErrGIDNotFound
+	case invalidOption(msg):
+		e.kind = ErrInvalidOption
+	}
+
+	return e
+}
+
+// invalidOption reports whether msg, in lower case, is a fault of aria2 for
+// an option it rejected, e.g. "We encountered a problem while processing the
+// option '--split'.".
+func invalidOption(msg string) bool {
+	switch {
+	case strings.Contains(msg, "while processing the option"),
+		strings.Contains(msg, "is not a valid option"),
+		strings.Contains(msg, "no such option"):
+		return true
+	}
+	msg = strings.TrimSuffix(msg, ".")
+	return strings.HasPrefix(msg, "option ") && strings.HasSuffix(msg, " is invalid")
+}
+
+// ExitCode is an aria2 exit status, it is also reported as the errorCode of
+// stopped downloads. It implements error so it can be used as a target for
+// errors.Is, e.g. errors.Is(err, ario.ExitTimeout).
+//
+// see: https://aria2.github.io/manual/en/html/aria2c.html#exit-status
+type ExitCode int
+
+const (
+	ExitSuccess                ExitCode = iota // All downloads were successful.
+	ExitUnknownError                           // An unknown error occurred.
+	ExitTimeout                                // Time out occurred.
+	ExitResourceNotFound                       // A resource was not found.
+	ExitMaxFileNotFound                        // aria2 saw the specified number of "resource not found" errors.
+	ExitTooSlow                                // Download speed was too slow.
+	ExitNetworkProblem                         // Network problem occurred.
+	ExitInProgress                             // There were unfinished downloads.
+	ExitCannotResume                           // Remote server did not support resume.
+	ExitNotEnoughDiskSpace                     // There was not enough disk space available.
+	ExitPieceLengthChanged                     // Piece length was different from the one in the .aria2 control file.
+	ExitDuplicateDownload                      // aria2 was downloading the same file at that moment.
+	ExitDuplicateInfoHash                      // aria2 was downloading the same info hash torrent at that moment.
+	ExitFileAlreadyExists                      // File already existed.
+	ExitFileRenamingFailed                     // Renaming file failed.
+	ExitFileOpenError                          // aria2 could not open an existing file.
+	ExitFileCreateError                        // aria2 could not create a new file or truncate an existing file.
+	ExitFileIOError                            // File I/O error occurred.
+	ExitDirCreateError                         // aria2 could not create a directory.
+	ExitNameResolveError                       // Name resolution failed.
+	ExitMetalinkParseError                     // aria2 could not parse a Metalink document.
+	ExitFTPProtocolError                       // FTP command failed.
+	ExitHTTPProtocolError                      // HTTP response header was bad or unexpected.
+	ExitHTTPTooManyRedirects                   // Too many redirects occurred.
+	ExitHTTPAuthFailed                         // HTTP authorization failed.
+	ExitBencodeParseError                      // aria2 could not parse a bencoded file.
+	ExitBittorrentParseError                   // The .torrent file was corrupted or missing information.
+	ExitMagnetParseError                       // Magnet URI was bad.
+	ExitOptionError                            // Bad/unrecognized option was given or an unexpected option argument was given.
+	ExitHTTPServiceUnavailable                 // The remote server was unable to handle the request due to a temporary overloading or maintenance.
+	ExitJSONParseError                         // aria2 could not parse a JSON-RPC request.
+	ExitReserved                               // Reserved. Not used.
+	ExitChecksumError                          // Checksum validation failed.
+)
+
+type exitInfo struct {
+	name        string
+	description string
+	retryable   bool
+}
+
+var exitCodes = [...]exitInfo{
+	ExitSuccess:                {"success", "all downloads were successful", false},
+	ExitUnknownError:           {"unknown error", "an unknown error occurred", false},
+	ExitTimeout:                {"timeout", "time out occurred", true},
+	ExitResourceNotFound:       {"resource not found", "a resource was not found", false},
+	ExitMaxFileNotFound:        {"max file not found", "aria2 saw the specified number of \"resource not found\" errors", false},
+	ExitTooSlow:                {"too slow", "download was aborted because download speed was too slow", true},
+	ExitNetworkProblem:         {"network problem", "network problem occurred", true},
+	ExitInProgress:             {"in progress", "there were unfinished downloads", true},
+	ExitCannotResume:           {"cannot resume", "remote server did not support resume when resume was required", false},
+	ExitNotEnoughDiskSpace:     {"not enough disk space", "there was not enough disk space available", false},
+	ExitPieceLengthChanged:     {"piece length changed", "piece length was different from the one in the .aria2 control file", false},
+	ExitDuplicateDownload:      {"duplicate download", "aria2 was downloading the same file at that moment", false},
+	ExitDuplicateInfoHash:      {"duplicate info hash", "aria2 was downloading the same info hash torrent at that moment", false},
+	ExitFileAlreadyExists:      {"file already exists", "file already existed", false},
+	ExitFileRenamingFailed:     {"file renaming failed", "renaming file failed", false},
+	ExitFileOpenError:          {"file open error", "aria2 could not open an existing file", false},
+	ExitFileCreateError:        {"file create error", "aria2 could not create a new file or truncate an existing file", false},
+	ExitFileIOError:            {"file I/O error", "file I/O error occurred", false},
+	ExitDirCreateError:         {"dir create error", "aria2 could not create a directory", false},
+	ExitNameResolveError:       {"name resolve error", "name resolution failed", true},
+	ExitMetalinkParseError:     {"metalink parse error", "aria2 could not parse a Metalink document", false},
+	ExitFTPProtocolError:       {"ftp protocol error", "FTP command failed", true},
+	ExitHTTPProtocolError:      {"http protocol error", "HTTP response header was bad or unexpected", true},
+	ExitHTTPTooManyRedirects:   {"http too many redirects", "too many redirects occurred", false},
+	ExitHTTPAuthFailed:         {"http auth failed", "HTTP authorization failed", false},
+	ExitBencodeParseError:      {"bencode parse error", "aria2 could not parse a bencoded file", false},
+	ExitBittorrentParseError:   {"bittorrent parse error", "the .torrent file was corrupted or missing information", false},
+	ExitMagnetParseError:       {"magnet parse error", "magnet URI was bad", false},
+	ExitOptionError:            {"option error", "bad/unrecognized option was given or an unexpected option argument was given", false},
+	ExitHTTPServiceUnavailable: {"http service unavailable", "the remote server was unable to handle the request due to a temporary overloading or maintenance", true},
+	ExitJSONParseError:         {"json parse error", "aria2 could not parse a JSON-RPC request", false},
+	ExitReserved:               {"reserved", "reserved, not used", false},
+	ExitChecksumError:          {"checksum error", "checksum validation failed", true},
+}
+
+func (c ExitCode) info() exitInfo {
+	if c < 0 || int(c) >= len(exitCodes) {
+		return exitInfo{name: "exit code " + strconv.Itoa(int(c)), description: "unknown exit status"}
+	}
+	return exitCodes[c]
+}
+
+// Name returns a short name of the exit status, e.g. "network problem".
+func (c ExitCode) Name() string { return c.info().name }
+
+// Description returns the description of the exit status from the aria2 manual.
+func (c ExitCode) Description() string { return c.info().description }
+
+// Retryable reports whether a download that failed with this exit status is
+// likely to succeed if it is tried again.
+func (c ExitCode) Retryable() bool { return c.info().retryable }
+
+func (c ExitCode) Error() string { return c.Name() }
+
+// DownloadError represents a download that was stopped because of an error.
+type DownloadError struct {
+	Gid     string   // GID of the download
+	Code    ExitCode // errorCode of the download
+	Message string   // errorMessage reported by aria2, may be empty
+}
+
+func (e *DownloadError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("download %s: %s (%d): %s", e.Gid, e.Code.Name(), int(e.Code), e.Message)
+	}
+	return fmt.Sprintf("download %s: %s (%d): %s", e.Gid, e.Code.Name(), int(e.Code), e.Code.Description())
+}
+
+// Unwrap returns the exit code of the download.
+func (e *DownloadError) Unwrap() error {
+	return e.Code
+}
+
+// Retryable reports whether the download is likely to succeed if it is tried again.
+func (e *DownloadError) Retryable() bool {
+	return e.Code.Retryable()
+}
+
+// StatusError returns a *DownloadError for a status with a non-zero errorCode,
+// or nil if the download has not failed.
+func StatusError(status resp.Status) error {
+	if status.ErrorCode == 0 {
+		return nil
+	}
+
+	return &DownloadError{
+		Gid:     status.Gid,
+		Code:    ExitCode(status.ErrorCode),
+		Message: status.ErrorMessage,
+	}
+}
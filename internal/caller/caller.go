@@ -1,37 +1,138 @@
 package caller
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
+
+	"github.com/creachadair/jrpc2"
+)
+
+// State is the state of the connection of a WebSocket caller.
+type State int
+
+const (
+	StateConnected    State = iota // the connection is established
+	StateDisconnected              // the connection was lost
+	StateReconnecting              // a reconnection attempt is about to be made
 )
 
+func (s State) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateDisconnected:
+		return "disconnected"
+	case StateReconnecting:
+		return "reconnecting"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Spec is a call sent in a batch, its result is decoded into Reply if not nil.
+type Spec struct {
+	Method string
+	Params any
+	Reply  any
+}
+
 type Caller struct {
-	Call  func(method string, params, reply any) error
+	Call func(ctx context.Context, method string, params, reply any) error
+	// Batch sends specs in a single JSON-RPC batch, and returns the error of
+	// each call in the same order. The error is not nil if the batch could
+	// not be sent at all.
+	Batch func(ctx context.Context, specs []Spec) ([]error, error)
 	Close func() error
+	// OnStateChange registers a function called when the state of the
+	// connection changes, and returns a function that unregisters it.
+	// HTTP callers have no connection state and never call it.
+	OnStateChange func(fn func(State)) (unregister func())
+	// Subscribe registers a function called with the notifications pushed by
+	// aria2 over the connection, and returns a function that unregisters it.
+	// fn must not block. It is nil for HTTP callers, which cannot receive
+	// notifications.
+	Subscribe func(fn func(method string, params json.RawMessage)) (unsubscribe func())
+}
+
+// Options configure the transport of a caller. A nil *Options is valid and
+// provides the defaults.
+type Options struct {
+	// HTTPClient sends the HTTP calls and the WebSocket handshakes, if nil
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+	// Header is added to every HTTP request and WebSocket handshake.
+	Header http.Header
+}
+
+func (o *Options) httpClient() *http.Client {
+	if o == nil || o.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return o.HTTPClient
+}
+
+func (o *Options) header() http.Header {
+	if o == nil {
+		return nil
+	}
+	return o.Header
 }
 
-func NewCaller(host *url.URL) (*Caller, error) {
+func NewCaller(host *url.URL, opts *Options) (*Caller, error) {
 	rpc := &Caller{}
 
 	switch host.Scheme {
 	case "http", "https":
-		h, err := newHttpCaller(host.String())
+		h, err := newHttpCaller(host.String(), opts)
 		if err != nil {
 			return nil, err
 		}
 
 		rpc.Call = h.call
+		rpc.Batch = h.batch
 		rpc.Close = h.close
+		rpc.OnStateChange = func(func(State)) func() { return func() {} }
 	case "ws", "wss":
-		w, err := newWsCaller(host.String())
+		w, err := newWsCaller(host.String(), opts)
 		if err != nil {
 			return nil, err
 		}
 
 		rpc.Call = w.call
+		rpc.Batch = w.batch
 		rpc.Close = w.close
+		rpc.OnStateChange = w.onStateChange
+		rpc.Subscribe = w.subscribe
 	default:
 		return nil, fmt.Errorf("unsupported scheme: %s", host.Scheme)
 	}
 	return rpc, nil
 }
+
+// batch sends specs with rc, see Caller.Batch.
+func batch(ctx context.Context, rc *jrpc2.Client, specs []Spec) ([]error, error) {
+	calls := make([]jrpc2.Spec, len(specs))
+	for i, s := range specs {
+		calls[i] = jrpc2.Spec{Method: s.Method, Params: s.Params}
+	}
+
+	rsps, err := rc.Batch(ctx, calls)
+	if err != nil {
+		return nil, err
+	}
+	if len(rsps) != len(specs) {
+		return nil, fmt.Errorf("got %d responses for %d calls", len(rsps), len(specs))
+	}
+
+	errs := make([]error, len(specs))
+	for i, rsp := range rsps {
+		if err := rsp.Error(); err != nil {
+			errs[i] = err
+		} else if specs[i].Reply != nil {
+			errs[i] = rsp.UnmarshalResult(specs[i].Reply)
+		}
+	}
+	return errs, nil
+}
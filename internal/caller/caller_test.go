@@ -1,17 +1,23 @@
 package caller
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"testing"
+	"time"
 
-	"github.com/kahosan/aria2-rpc/internal/resp"
-	"github.com/kahosan/aria2-rpc/internal/testutils"
+	"github.com/kahosan/aria2-rpc/ariotest"
+	"github.com/kahosan/aria2-rpc/resp"
 )
 
 func TestHTTPRPC(t *testing.T) {
-	uri, _ := url.Parse(testutils.Arai2Uri("https://"))
-	c, err := NewCaller(uri)
+	srv := ariotest.NewServer()
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	c, err := NewCaller(uri, nil)
 	if err != nil {
 		fmt.Println(err)
 		t.Fatal("NewCaller should not return error")
@@ -19,7 +25,7 @@ func TestHTTPRPC(t *testing.T) {
 
 	t.Run("connect should not be error", func(t *testing.T) {
 		r := resp.Version{}
-		err = c.Call("aria2.getVersion", nil, &r)
+		err = c.Call(context.Background(), "aria2.getVersion", nil, &r)
 		if err != nil {
 			t.Fatal("get version failed: ", err)
 		}
@@ -28,23 +34,30 @@ func TestHTTPRPC(t *testing.T) {
 	})
 
 	t.Run("when reply is nil, error should not be returned.", func(t *testing.T) {
-		err = c.Call("aria2.getVersion", nil, nil)
+		err = c.Call(context.Background(), "aria2.getVersion", nil, nil)
 		if err != nil {
 			t.Fatal("get version failed: ", err)
 		}
 	})
+
+	t.Run("batch reports an error per call", func(t *testing.T) {
+		testBatch(t, c)
+	})
 }
 
 func TestWSRPC(t *testing.T) {
-	uri, _ := url.Parse(testutils.Arai2Uri("wss://"))
-	c, err := NewCaller(uri)
+	srv := ariotest.NewServer()
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.WSURL)
+	c, err := NewCaller(uri, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	t.Run("connect should not be error", func(t *testing.T) {
 		r := resp.Version{}
-		err = c.Call("aria2.getVersion", nil, &r)
+		err = c.Call(context.Background(), "aria2.getVersion", nil, &r)
 		if err != nil {
 			t.Fatal("get version failed: ", err)
 		}
@@ -53,9 +66,80 @@ func TestWSRPC(t *testing.T) {
 	})
 
 	t.Run("when reply is nil, error should not be returned.", func(t *testing.T) {
-		err = c.Call("aria2.getVersion", nil, nil)
+		err = c.Call(context.Background(), "aria2.getVersion", nil, nil)
 		if err != nil {
 			t.Fatal("get version failed: ", err)
 		}
 	})
+
+	t.Run("batch reports an error per call", func(t *testing.T) {
+		testBatch(t, c)
+	})
+
+	t.Run("reconnect after the connection is lost", func(t *testing.T) {
+		states := make(chan State, 10)
+		unregister := c.OnStateChange(func(s State) { states <- s })
+		defer unregister()
+
+		srv.CloseConnections()
+
+		r := resp.Version{}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := c.Call(ctx, "aria2.getVersion", nil, &r); err != nil {
+			t.Fatal("get version failed: ", err)
+		}
+
+		for _, want := range []State{StateDisconnected, StateReconnecting, StateConnected} {
+			if got := <-states; got != want {
+				t.Fatalf("expected state %v, got %v", want, got)
+			}
+		}
+	})
+
+	t.Run("notifications are delivered to subscribers", func(t *testing.T) {
+		methods := make(chan string, 1)
+		unsubscribe := c.Subscribe(func(method string, params json.RawMessage) {
+			t.Log(method, string(params))
+			methods <- method
+		})
+		defer unsubscribe()
+
+		srv.Notify(ariotest.OnDownloadStart, "2089b05ecca3d829")
+
+		select {
+		case m := <-methods:
+			if m != ariotest.OnDownloadStart {
+				t.Fatal("unexpected method: ", m)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("notification was not delivered")
+		}
+	})
+}
+
+func testBatch(t *testing.T, c *Caller) {
+	var version resp.Version
+	var status resp.Status
+	errs, err := c.Batch(context.Background(), []Spec{
+		{Method: "aria2.getVersion", Reply: &version},
+		{Method: "aria2.tellStatus", Params: []any{"0000000000000000"}, Reply: &status},
+		{Method: "aria2.getGlobalStat"},
+	})
+	if err != nil {
+		t.Fatal("batch failed: ", err)
+	}
+
+	if len(errs) != 3 {
+		t.Fatal("expected 3 errors, got: ", len(errs))
+	}
+	if errs[0] != nil || version.Version == "" {
+		t.Fatal("get version failed: ", errs[0])
+	}
+	if errs[1] == nil {
+		t.Fatal("tell status of an unknown gid should fail")
+	}
+	if errs[2] != nil {
+		t.Fatal("get global stat failed: ", errs[2])
+	}
 }
@@ -2,6 +2,8 @@ package caller
 
 import (
 	"context"
+	"net/http"
+	"strings"
 
 	"github.com/creachadair/jrpc2"
 	"github.com/creachadair/jrpc2/jhttp"
@@ -13,8 +15,10 @@ type httpCaller struct {
 	close func() error
 }
 
-func newHttpCaller(host string) (*httpCaller, error) {
-	ch := jhttp.NewChannel(host, nil)
+func newHttpCaller(host string, opts *Options) (*httpCaller, error) {
+	ch := jhttp.NewChannel(host, &jhttp.ChannelOptions{
+		Client: statusClient{opts.httpClient(), opts.header()},
+	})
 	rc := jrpc2.NewClient(ch, nil)
 
 	c := &httpCaller{
@@ -27,11 +31,38 @@ func newHttpCaller(host string) (*httpCaller, error) {
 }
 
 // http call
-func (h *httpCaller) call(method string, params, reply any) error {
+func (h *httpCaller) call(ctx context.Context, method string, params, reply any) error {
 	if reply == nil {
-		_, err := h.rc.Call(context.Background(), method, params)
+		_, err := h.rc.Call(ctx, method, params)
 		return err
 	}
 
-	return h.rc.CallResult(context.Background(), method, params, reply)
+	return h.rc.CallResult(ctx, method, params, reply)
+}
+
+// http batch
+func (h *httpCaller) batch(ctx context.Context, specs []Spec) ([]error, error) {
+	return batch(ctx, h.rc, specs)
+}
+
+// aria2 replies to a failed call with a 4xx/5xx status and the error object
+// in the body, but jhttp treats any status other than 200 as a broken channel
+// and stops the client. statusClient passes those replies through as 200 so
+// the error is reported for the call instead. It also adds the configured
+// headers to the requests.
+type statusClient struct {
+	jhttp.HTTPClient
+	header http.Header
+}
+
+func (s statusClient) Do(req *http.Request) (*http.Response, error) {
+	for k, v := range s.header {
+		req.Header[k] = v
+	}
+
+	rsp, err := s.HTTPClient.Do(req)
+	if err == nil && rsp.StatusCode != http.StatusOK && strings.Contains(rsp.Header.Get("Content-Type"), "json") {
+		rsp.StatusCode = http.StatusOK
+	}
+	return rsp, err
 }
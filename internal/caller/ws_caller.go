@@ -2,39 +2,338 @@ package caller
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
 
 	"github.com/creachadair/jrpc2"
 	"github.com/creachadair/wschannel"
 )
 
+// ErrDisconnected is returned for a call that was in flight when the
+// connection was lost, and that cannot be sent again safely.
+var ErrDisconnected = errors.New("connection to aria2 was lost")
+
+var errClosed = errors.New("caller is closed")
+
+// delays between reconnection attempts, see Backoff.
+var (
+	minBackoff = 250 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// methods that only read state, a call to one of them that was in flight when
+// the connection was lost is sent again after reconnecting.
+var idempotent = map[string]bool{
+	"aria2.tellStatus":         true,
+	"aria2.getUris":            true,
+	"aria2.getFiles":           true,
+	"aria2.getPeers":           true,
+	"aria2.getServers":         true,
+	"aria2.tellActive":         true,
+	"aria2.tellWaiting":        true,
+	"aria2.tellStopped":        true,
+	"aria2.getOption":          true,
+	"aria2.getGlobalOption":    true,
+	"aria2.getGlobalStat":      true,
+	"aria2.getVersion":         true,
+	"aria2.getSessionInfo":     true,
+	"system.listMethods":       true,
+	"system.listNotifications": true,
+}
+
 type wsCaller struct {
-	host  string
-	rc    *jrpc2.Client
-	close func() error
+	host string
+	opts *wschannel.DialOptions
+
+	mu       sync.Mutex
+	rc       *jrpc2.Client // nil while reconnecting
+	ready    chan struct{} // closed when rc is set
+	closed   bool
+	done     chan struct{} // closed by close
+	handlers map[int]func(State)
+	notifees map[int]func(method string, params json.RawMessage)
+	nextID   int
+}
+
+func newWsCaller(host string, opts *Options) (*wsCaller, error) {
+	w := &wsCaller{
+		host: host,
+		opts: &wschannel.DialOptions{
+			HTTPClient: opts.httpClient(),
+			HTTPHeader: opts.header(),
+		},
+		ready:    make(chan struct{}),
+		done:     make(chan struct{}),
+		handlers: make(map[int]func(State)),
+		notifees: make(map[int]func(method string, params json.RawMessage)),
+	}
+
+	rc, err := w.dial()
+	if err != nil {
+		return nil, err
+	}
+	w.connected(rc)
+
+	return w, nil
 }
 
-func newWsCaller(host string) (*wsCaller, error) {
-	ch, err := wschannel.Dial(host, nil)
+func (w *wsCaller) dial() (*jrpc2.Client, error) {
+	ch, err := wschannel.Dial(w.host, w.opts)
 	if err != nil {
 		return nil, err
 	}
-	rc := jrpc2.NewClient(ch, nil)
 
-	c := &wsCaller{
-		host:  host,
-		rc:    rc,
-		close: rc.Close,
+	return jrpc2.NewClient(ch, &jrpc2.ClientOptions{
+		OnNotify: w.notify,
+		OnStop:   func(cli *jrpc2.Client, _ error) { w.lost(cli) },
+	}), nil
+}
+
+// connected installs rc as the current connection.
+func (w *wsCaller) connected(rc *jrpc2.Client) bool {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		rc.Close()
+		return false
+	}
+	w.rc = rc
+	close(w.ready)
+	w.mu.Unlock()
+
+	// the connection may have dropped before it was installed, in which case
+	// the OnStop hook ignored it.
+	if rc.IsStopped() {
+		w.lost(rc)
+	}
+	return true
+}
+
+// lost is called when the connection of rc is closed.
+func (w *wsCaller) lost(rc *jrpc2.Client) {
+	w.mu.Lock()
+	if w.closed || w.rc != rc {
+		w.mu.Unlock()
+		return
+	}
+	w.rc = nil
+	w.ready = make(chan struct{})
+	w.mu.Unlock()
+
+	w.setState(StateDisconnected)
+	go w.reconnect()
+}
+
+// reconnect dials until a connection is made or the caller is closed.
+func (w *wsCaller) reconnect() {
+	for attempt := 0; ; attempt++ {
+		w.setState(StateReconnecting)
+
+		select {
+		case <-time.After(Backoff(attempt)):
+		case <-w.done:
+			return
+		}
+
+		rc, err := w.dial()
+		if err != nil {
+			continue
+		}
+
+		if w.connected(rc) {
+			w.setState(StateConnected)
+		}
+		return
+	}
+}
+
+// Backoff returns the delay before a reconnection attempt: an exponential
+// backoff capped at maxBackoff, with a random jitter of up to half of it.
+func Backoff(attempt int) time.Duration {
+	d := maxBackoff
+	if attempt < 16 {
+		d = min(minBackoff<<attempt, maxBackoff)
 	}
+	return d/2 + rand.N(d/2)
+}
+
+// client returns the current connection, waiting for it to be re-established
+// if needed.
+func (w *wsCaller) client(ctx context.Context) (*jrpc2.Client, error) {
+	for {
+		w.mu.Lock()
+		rc, ready, closed := w.rc, w.ready, w.closed
+		w.mu.Unlock()
 
-	return c, nil
+		if closed {
+			return nil, errClosed
+		}
+		if rc != nil {
+			return rc, nil
+		}
+
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-w.done:
+			return nil, errClosed
+		}
+	}
 }
 
 // websocket call
-func (w *wsCaller) call(method string, params, reply any) error {
-	if reply == nil {
-		_, err := w.rc.Call(context.Background(), method, params)
-		return err
+//
+// While the connection is down, calls wait for it to be re-established until
+// their context ends. Calls to idempotent methods that were in flight when the
+// connection was lost are sent again, others fail with ErrDisconnected since
+// they may have been executed by aria2.
+func (w *wsCaller) call(ctx context.Context, method string, params, reply any) error {
+	for {
+		rc, err := w.client(ctx)
+		if err != nil {
+			return err
+		}
+
+		if reply == nil {
+			_, err = rc.Call(ctx, method, params)
+		} else {
+			err = rc.CallResult(ctx, method, params, reply)
+		}
+
+		if err == nil || ctx.Err() != nil || !rc.IsStopped() {
+			return err
+		}
+
+		// the connection was lost while the call was in flight
+		w.mu.Lock()
+		closed := w.closed
+		w.mu.Unlock()
+
+		if closed {
+			return err
+		}
+		if !idempotent[method] {
+			return ErrDisconnected
+		}
+	}
+}
+
+// websocket batch
+//
+// As for call, the batch is sent again if the connection was lost while it was
+// in flight and all of its methods are idempotent.
+func (w *wsCaller) batch(ctx context.Context, specs []Spec) ([]error, error) {
+	for {
+		rc, err := w.client(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		errs, err := batch(ctx, rc, specs)
+		if (err == nil && !anyLost(errs)) || ctx.Err() != nil || !rc.IsStopped() {
+			return errs, err
+		}
+
+		// the connection was lost while the batch was in flight
+		w.mu.Lock()
+		closed := w.closed
+		w.mu.Unlock()
+
+		if closed {
+			return errs, err
+		}
+		for _, s := range specs {
+			if !idempotent[s.Method] {
+				return nil, ErrDisconnected
+			}
+		}
 	}
+}
+
+// anyLost reports whether one of errs is not a fault reported by aria2.
+func anyLost(errs []error) bool {
+	for _, err := range errs {
+		var je *jrpc2.Error
+		if err != nil && !errors.As(err, &je) {
+			return true
+		}
+	}
+	return false
+}
 
-	return w.rc.CallResult(context.Background(), method, params, reply)
+func (w *wsCaller) close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.done)
+	rc := w.rc
+	w.mu.Unlock()
+
+	if rc != nil {
+		return rc.Close()
+	}
+	return nil
+}
+
+func (w *wsCaller) onStateChange(fn func(State)) func() {
+	w.mu.Lock()
+	id := w.nextID
+	w.nextID++
+	w.handlers[id] = fn
+	w.mu.Unlock()
+
+	return func() {
+		w.mu.Lock()
+		delete(w.handlers, id)
+		w.mu.Unlock()
+	}
+}
+
+func (w *wsCaller) subscribe(fn func(method string, params json.RawMessage)) func() {
+	w.mu.Lock()
+	id := w.nextID
+	w.nextID++
+	w.notifees[id] = fn
+	w.mu.Unlock()
+
+	return func() {
+		w.mu.Lock()
+		delete(w.notifees, id)
+		w.mu.Unlock()
+	}
+}
+
+// notify delivers a notification pushed by aria2 to the subscribers.
+func (w *wsCaller) notify(req *jrpc2.Request) {
+	w.mu.Lock()
+	notifees := make([]func(string, json.RawMessage), 0, len(w.notifees))
+	for _, fn := range w.notifees {
+		notifees = append(notifees, fn)
+	}
+	w.mu.Unlock()
+
+	params := json.RawMessage(req.ParamString())
+	for _, fn := range notifees {
+		fn(req.Method(), params)
+	}
+}
+
+func (w *wsCaller) setState(s State) {
+	w.mu.Lock()
+	handlers := make([]func(State), 0, len(w.handlers))
+	for _, fn := range w.handlers {
+		handlers = append(handlers, fn)
+	}
+	w.mu.Unlock()
+
+	for _, fn := range handlers {
+		fn(s)
+	}
 }
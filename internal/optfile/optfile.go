@@ -0,0 +1,98 @@
+// Package optfile converts options between the name=value lines of the aria2
+// files and the option types of ario.
+package optfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	ario "github.com/kahosan/aria2-rpc"
+)
+
+// Cut splits a name=value line, with the spaces around both trimmed.
+func Cut(line string) (name, value string, err error) {
+	name, value, ok := strings.Cut(line, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("expected name=value, got %q", strings.TrimSpace(line))
+	}
+	return name, strings.TrimSpace(value), nil
+}
+
+// IsList reports whether the option name can be given several times.
+func IsList(name string) bool {
+	info, ok := ario.LookupOption(name)
+	return ok && info.Type == ario.OptionList
+}
+
+// Add records value for the option name in values. The values of a list are
+// appended, the other options keep the last one.
+func Add(values map[string][]string, name, value string) {
+	if IsList(name) {
+		values[name] = append(values[name], value)
+	} else {
+		values[name] = []string{value}
+	}
+}
+
+// Decode sets v, an *ario.Options or *ario.GlobalOptions, from the values of
+// each option, through the same encoding as the options sent to aria2.
+func Decode(values map[string][]string, v any) error {
+	m := make(map[string]any, len(values))
+	for name, list := range values {
+		if IsList(name) {
+			m[name] = list
+		} else {
+			m[name] = list[len(list)-1]
+		}
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Encode returns the values of the options set in v, as sent to aria2.
+func Encode(v any) (map[string][]string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string][]string, len(m))
+	for name, raw := range m {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			values[name] = []string{s}
+			continue
+		}
+
+		var list []string
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, fmt.Errorf("option %s: %w", name, err)
+		}
+		if len(list) > 0 {
+			values[name] = list
+		}
+	}
+	return values, nil
+}
+
+// Names returns the names of the options in values, sorted.
+func Names(values map[string][]string) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
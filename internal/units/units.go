@@ -0,0 +1,21 @@
+// Package units formats sizes and speeds for display, for both ario and its
+// resp package.
+package units
+
+import "strconv"
+
+// Bytes formats n with a binary prefix, e.g. "1.5Mi", the unit is added by
+// the caller.
+func Bytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatInt(n, 10)
+	}
+
+	v, i := float64(n), -1
+	for v >= unit && i < 4 {
+		v /= unit
+		i++
+	}
+	return strconv.FormatFloat(v, 'f', 1, 64) + string("KMGTP"[i]) + "i"
+}
@@ -0,0 +1,328 @@
+// Package lifecycle tracks the state of aria2 downloads from the
+// notifications of aria2 and their status, and reports each transition.
+//
+// A download goes from waiting to active, possibly paused in between, and
+// ends complete, in error or removed. A BitTorrent download is seeding after
+// it completed, until it stops seeding. The time spent in each state is
+// recorded.
+package lifecycle
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	ario "github.com/kahosan/aria2-rpc"
+	"github.com/kahosan/aria2-rpc/notifier"
+	"github.com/kahosan/aria2-rpc/resp"
+)
+
+// State is the state of a download.
+type State string
+
+const (
+	StateUnknown  State = ""
+	StateWaiting  State = "waiting"
+	StateActive   State = "active"
+	StatePaused   State = "paused"
+	StateSeeding  State = "seeding"
+	StateComplete State = "complete"
+	StateError    State = "error"
+	StateRemoved  State = "removed"
+)
+
+// next lists the states that can follow each state. A paused download that
+// is resumed may start without being reported as waiting.
+var next = map[State][]State{
+	StateWaiting: {StateActive, StatePaused, StateError, StateRemoved},
+	StateActive:  {StatePaused, StateSeeding, StateComplete, StateError, StateRemoved},
+	StatePaused:  {StateWaiting, StateActive, StateRemoved},
+	StateSeeding: {StatePaused, StateComplete, StateError, StateRemoved},
+}
+
+// Final reports whether s is a state a download never leaves.
+func (s State) Final() bool {
+	return s == StateComplete || s == StateError || s == StateRemoved
+}
+
+// Allowed reports whether a download can go from one state to the other. Any
+// state can follow StateUnknown.
+func Allowed(from, to State) bool {
+	return from == StateUnknown || slices.Contains(next[from], to)
+}
+
+// FromStatus returns the state of a download from its status, which needs the
+// status and seeder keys.
+func FromStatus(s resp.Status) State {
+	if s.Status == resp.StatusActive && s.Seeder {
+		return StateSeeding
+	}
+	return State(s.Status)
+}
+
+var eventStates = map[notifier.EventKind]State{
+	notifier.KindStart:      StateActive,
+	notifier.KindPause:      StatePaused,
+	notifier.KindStop:       StateRemoved,
+	notifier.KindComplete:   StateComplete,
+	notifier.KindError:      StateError,
+	notifier.KindBtComplete: StateSeeding,
+}
+
+// Transition is a change of the state of a download.
+type Transition struct {
+	GID        string
+	From       State
+	To         State
+	At         time.Time
+	Impossible bool // To cannot follow From, a transition was missed
+}
+
+// Record is what a Tracker knows about a download.
+type Record struct {
+	GID        string
+	State      State
+	Since      time.Time               // when it entered State
+	Durations  map[State]time.Duration // time spent in each state, see Tracker.Record
+	Impossible int                     // number of impossible transitions
+}
+
+// Tracker keeps the state of the downloads.
+type Tracker struct {
+	c *ario.Client
+
+	mu      sync.Mutex
+	records map[string]*Record
+}
+
+// New returns a tracker of the downloads of the aria2 of c, which must have
+// been created with notifications enabled to Run.
+func New(c *ario.Client) *Tracker {
+	return &Tracker{c: c, records: make(map[string]*Record)}
+}
+
+// Observe records that the download gid entered the state to at the given
+// time, and returns the transition. It reports false if the download already
+// was in that state. Run calls it, it is exported to feed the tracker from
+// other sources.
+func (t *Tracker) Observe(gid string, to State, at time.Time) (Transition, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.records[gid]
+	if !ok {
+		r = &Record{GID: gid, Durations: make(map[State]time.Duration)}
+		t.records[gid] = r
+	}
+	if to == StateUnknown || to == r.State {
+		return Transition{}, false
+	}
+
+	if r.State != StateUnknown {
+		// notifications may be received out of order
+		at = later(at, r.Since)
+		r.Durations[r.State] += at.Sub(r.Since)
+	}
+
+	tr := Transition{GID: gid, From: r.State, To: to, At: at, Impossible: !Allowed(r.State, to)}
+	if tr.Impossible {
+		r.Impossible++
+	}
+	r.State, r.Since = to, at
+	return tr, true
+}
+
+// Record returns what the tracker knows about gid. The durations include the
+// time spent in the current state until now, unless it is final.
+func (t *Tracker) Record(gid string) (Record, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.records[gid]
+	if !ok {
+		return Record{}, false
+	}
+	return r.snapshot(time.Now()), true
+}
+
+// Records returns the records of every download, sorted by GID.
+func (t *Tracker) Records() []Record {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	records := make([]Record, 0, len(t.records))
+	for _, r := range t.records {
+		records = append(records, r.snapshot(now))
+	}
+	slices.SortFunc(records, func(a, b Record) int { return cmp.Compare(a.GID, b.GID) })
+	return records
+}
+
+// Forget removes the records of gids, e.g. once they were reported.
+func (t *Tracker) Forget(gids ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, gid := range gids {
+		delete(t.records, gid)
+	}
+}
+
+func (r *Record) snapshot(now time.Time) Record {
+	cp := *r
+	cp.Durations = maps.Clone(r.Durations)
+	if r.State != StateUnknown && !r.State.Final() {
+		cp.Durations[r.State] += later(now, r.Since).Sub(r.Since)
+	}
+	return cp
+}
+
+// Run records the state of the downloads known to aria2, then follows the
+// notifications until ctx ends. The transitions are sent to the returned
+// channel, which must be read, and is closed when ctx ends.
+//
+// After each notification the status of the download is fetched, so that
+// the state is right even if a notification was missed or received out of
+// order.
+func (t *Tracker) Run(ctx context.Context) (<-chan Transition, error) {
+	n, err := t.c.NotifyListener(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sub := n.Subscribe(notifier.WithOverflow(notifier.OverflowBlock))
+
+	initial, err := t.seed(ctx)
+	if err != nil {
+		n.Close()
+		return nil, err
+	}
+
+	ch := make(chan Transition)
+	go func() {
+		defer close(ch)
+		defer n.Close()
+
+		send := func(transitions []Transition) bool {
+			for _, tr := range transitions {
+				select {
+				case ch <- tr:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return true
+		}
+
+		if !send(initial) {
+			return
+		}
+		for {
+			select {
+			case e, ok := <-sub.Events():
+				if !ok || !send(t.handle(ctx, e)) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+var statusKeys = []string{"gid", "status", "seeder"}
+
+// seed records the state of the downloads known to aria2, up to the first
+// page of the waiting and stopped ones, the others are tracked once notified.
+func (t *Tracker) seed(ctx context.Context) ([]Transition, error) {
+	const page = 1000
+
+	b := t.c.NewBatch()
+	futures := []*ario.Future[[]resp.Status]{
+		b.TellActive(statusKeys...),
+		b.TellWaiting(0, page, statusKeys...),
+		b.TellStopped(0, page, statusKeys...),
+	}
+	if err := b.RunContext(ctx); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var transitions []Transition
+	for _, f := range futures {
+		list, err := f.Get()
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range list {
+			if tr, ok := t.Observe(s.Gid, FromStatus(s), now); ok {
+				transitions = append(transitions, tr)
+			}
+		}
+	}
+	return transitions, nil
+}
+
+// handle applies the state of the status of the download, preceded by the
+// one implied by e if the download may have gone through it since the last
+// known state. A stale event, e.g. a start received after the download
+// completed, is thus not recorded.
+func (t *Tracker) handle(ctx context.Context, e notifier.Event) []Transition {
+	implied, ok := eventStates[e.Kind]
+	if !ok || e.Gid == "" {
+		return nil
+	}
+
+	last, _ := t.Record(e.Gid)
+	s, err := t.c.TellStatusContext(ctx, e.Gid, statusKeys...)
+	var to State
+	switch {
+	case err == nil:
+		to = FromStatus(s)
+	case errors.Is(err, ario.ErrGIDNotFound):
+		// purged, once it stopped, as the event tells if it is final
+		switch {
+		case last.State.Final():
+			to = last.State
+		case implied.Final():
+			to = implied
+		default:
+			to = StateRemoved
+		}
+	default:
+		// the status is unknown, the event is trusted if it can follow
+		to = implied
+		if !Allowed(last.State, to) {
+			return nil
+		}
+	}
+
+	var transitions []Transition
+	observe := func(to State, at time.Time) {
+		if tr, ok := t.Observe(e.Gid, to, at); ok {
+			transitions = append(transitions, tr)
+		}
+	}
+
+	at := time.Now()
+	if implied == to {
+		at = e.Time
+	} else if Allowed(last.State, implied) && Allowed(implied, to) {
+		observe(implied, e.Time)
+	}
+	observe(to, at)
+	return transitions
+}
+
+func later(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return b
+	}
+	return a
+}
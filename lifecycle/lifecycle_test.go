@@ -0,0 +1,145 @@
+package lifecycle_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ario "github.com/kahosan/aria2-rpc"
+	"github.com/kahosan/aria2-rpc/ariotest"
+	"github.com/kahosan/aria2-rpc/lifecycle"
+)
+
+func TestTracker(t *testing.T) {
+
+	t.Run("observe", func(t *testing.T) {
+		tr := lifecycle.New(nil)
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		steps := []struct {
+			to         lifecycle.State
+			after      time.Duration
+			impossible bool
+		}{
+			{lifecycle.StateWaiting, 0, false},
+			{lifecycle.StateActive, time.Minute, false},
+			{lifecycle.StatePaused, 3 * time.Minute, false},
+			{lifecycle.StateActive, 4 * time.Minute, false},
+			{lifecycle.StateWaiting, 5 * time.Minute, true},
+			{lifecycle.StateComplete, 7 * time.Minute, true},
+		}
+		for _, s := range steps {
+			got, ok := tr.Observe("2089b05ecca3d829", s.to, start.Add(s.after))
+			if !ok || got.To != s.to || got.Impossible != s.impossible || !got.At.Equal(start.Add(s.after)) {
+				t.Fatalf("unexpected transition %+v", got)
+			}
+		}
+		if _, ok := tr.Observe("2089b05ecca3d829", lifecycle.StateComplete, start.Add(8*time.Minute)); ok {
+			t.Fatal("the state did not change")
+		}
+
+		r, ok := tr.Record("2089b05ecca3d829")
+		if !ok || r.State != lifecycle.StateComplete || r.Impossible != 2 {
+			t.Fatalf("unexpected record %+v", r)
+		}
+		want := map[lifecycle.State]time.Duration{
+			lifecycle.StateWaiting: 3 * time.Minute,
+			lifecycle.StateActive:  3 * time.Minute,
+			lifecycle.StatePaused:  time.Minute,
+		}
+		for s, d := range want {
+			if r.Durations[s] != d {
+				t.Fatalf("unexpected durations %v", r.Durations)
+			}
+		}
+
+		tr.Forget("2089b05ecca3d829")
+		if len(tr.Records()) != 0 {
+			t.Fatal("the record should be forgotten")
+		}
+	})
+
+	t.Run("run", func(t *testing.T) {
+		srv := ariotest.NewServer()
+		defer srv.Close()
+
+		client, err := ario.NewClient(srv.WSURL, "", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		paused, err := client.AddURI([]string{"https://example.com/paused.iso"}, &ario.Options{Pause: ario.Ptr(true)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		tracker := lifecycle.New(client)
+		transitions, err := tracker.Run(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expect := func(gid string, from, to lifecycle.State) {
+			t.Helper()
+			select {
+			case tr := <-transitions:
+				if tr.GID != gid || tr.From != from || tr.To != to || tr.Impossible {
+					t.Fatalf("unexpected transition %+v, expected %s -> %s", tr, from, to)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("no transition %s -> %s", from, to)
+			}
+		}
+
+		expect(paused, lifecycle.StateUnknown, lifecycle.StatePaused)
+
+		gid, err := client.AddTorrent(&[]byte{'d', 'e'}, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect(gid, lifecycle.StateUnknown, lifecycle.StateActive)
+
+		if err := client.Pause(gid); err != nil {
+			t.Fatal(err)
+		}
+		expect(gid, lifecycle.StateActive, lifecycle.StatePaused)
+
+		if err := client.Unpause(gid); err != nil {
+			t.Fatal(err)
+		}
+		expect(gid, lifecycle.StatePaused, lifecycle.StateActive)
+
+		if err := srv.Complete(gid); err != nil {
+			t.Fatal(err)
+		}
+		expect(gid, lifecycle.StateActive, lifecycle.StateSeeding)
+
+		if err := srv.Complete(gid); err != nil {
+			t.Fatal(err)
+		}
+		expect(gid, lifecycle.StateSeeding, lifecycle.StateComplete)
+
+		if err := client.Remove(paused); err != nil {
+			t.Fatal(err)
+		}
+		expect(paused, lifecycle.StatePaused, lifecycle.StateRemoved)
+
+		// a stale start, received after the download completed
+		srv.Notify("aria2.onDownloadStart", gid)
+		select {
+		case tr := <-transitions:
+			t.Fatalf("unexpected transition %+v", tr)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		r, ok := tracker.Record(gid)
+		if !ok || r.State != lifecycle.StateComplete || r.Durations[lifecycle.StateActive] <= 0 || r.Impossible != 0 {
+			t.Fatalf("unexpected record %+v", r)
+		}
+		t.Log(r.Durations)
+	})
+}
@@ -0,0 +1,275 @@
+// Package magnet parses and builds BitTorrent magnet URIs.
+//
+// The supported parameters are xt (urn:btih in hex or base32, and urn:btmh
+// for v2 torrents), dn, xl, tr, ws and so.
+package magnet
+
+import (
+	"cmp"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kahosan/aria2-rpc/resp"
+	"github.com/kahosan/aria2-rpc/torrent"
+)
+
+// ErrInvalidMagnet is returned, wrapped, for a URI that is not a valid magnet
+// link.
+var ErrInvalidMagnet = errors.New("invalid magnet URI")
+
+// sha256Multihash is the prefix of a SHA-256 multihash, as used by urn:btmh.
+const sha256Multihash = "1220"
+
+// Magnet is a parsed magnet URI.
+type Magnet struct {
+	InfoHash   [20]byte // urn:btih, zero if the link only has a v2 hash
+	InfoHashV2 [32]byte // urn:btmh, zero if the link only has a v1 hash
+	Name       string   // dn, the display name
+	Length     int64    // xl, the total size, 0 if unknown
+	Trackers   []string // tr
+	WebSeeds   []string // ws
+	// SelectOnly is so, the files to download, e.g. "0,2-4". It counts files
+	// from 0, see SelectFile for the select-file option of aria2.
+	SelectOnly string
+}
+
+// Parse parses a magnet URI. The info hash is normalized, whether it was
+// given in hex or base32.
+func Parse(uri string) (*Magnet, error) {
+	query, ok := strings.CutPrefix(uri, "magnet:?")
+	if !ok {
+		return nil, fmt.Errorf("%w: not a magnet URI", ErrInvalidMagnet)
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMagnet, err)
+	}
+
+	m := &Magnet{}
+	hasHash := false
+	// sorted so that numbered parameters, e.g. tr.1 and tr.2, keep their order
+	for _, name := range slices.SortedFunc(maps.Keys(values), compareParams) {
+		key, _, _ := strings.Cut(name, ".")
+
+		for _, v := range values[name] {
+			switch key {
+			case "xt":
+				found, err := m.parseTopic(v)
+				if err != nil {
+					return nil, err
+				}
+				hasHash = hasHash || found
+			case "dn":
+				m.Name = v
+			case "xl":
+				n, err := strconv.ParseInt(v, 10, 64)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("%w: invalid xl %q", ErrInvalidMagnet, v)
+				}
+				m.Length = n
+			case "tr":
+				m.Trackers = appendNew(m.Trackers, v)
+			case "ws":
+				m.WebSeeds = appendNew(m.WebSeeds, v)
+			case "so":
+				if _, err := parseRanges(v); err != nil {
+					return nil, fmt.Errorf("%w: invalid so %q", ErrInvalidMagnet, v)
+				}
+				m.SelectOnly = v
+			}
+		}
+	}
+	if !hasHash {
+		return nil, fmt.Errorf("%w: no BitTorrent info hash", ErrInvalidMagnet)
+	}
+
+	return m, nil
+}
+
+// compareParams orders the names of parameters by key, then by index, e.g.
+// tr, tr.2 then tr.10.
+func compareParams(a, b string) int {
+	ka, ia, _ := strings.Cut(a, ".")
+	kb, ib, _ := strings.Cut(b, ".")
+	if c := strings.Compare(ka, kb); c != 0 {
+		return c
+	}
+
+	na, erra := strconv.Atoi(ia)
+	nb, errb := strconv.Atoi(ib)
+	if erra == nil && errb == nil {
+		return cmp.Compare(na, nb)
+	}
+	return strings.Compare(ia, ib)
+}
+
+// parseTopic sets the info hash from an xt value, and reports whether it was
+// one. Other kinds of topics, e.g. urn:ed2k, are ignored.
+func (m *Magnet) parseTopic(v string) (bool, error) {
+	switch {
+	case strings.HasPrefix(v, "urn:btih:"):
+		h := strings.TrimPrefix(v, "urn:btih:")
+		var b []byte
+		var err error
+		switch len(h) {
+		case 40:
+			b, err = hex.DecodeString(h)
+		case 32:
+			b, err = base32.StdEncoding.DecodeString(strings.ToUpper(h))
+		default:
+			err = errors.New("wrong length")
+		}
+		if err != nil {
+			return false, fmt.Errorf("%w: invalid btih %q", ErrInvalidMagnet, h)
+		}
+		copy(m.InfoHash[:], b)
+		return true, nil
+
+	case strings.HasPrefix(v, "urn:btmh:"):
+		h := strings.ToLower(strings.TrimPrefix(v, "urn:btmh:"))
+		digest, ok := strings.CutPrefix(h, sha256Multihash)
+		b, err := hex.DecodeString(digest)
+		if !ok || err != nil || len(b) != 32 {
+			return false, fmt.Errorf("%w: invalid btmh %q", ErrInvalidMagnet, h)
+		}
+		copy(m.InfoHashV2[:], b)
+		return true, nil
+	}
+	return false, nil
+}
+
+// FromTorrent returns the magnet URI of a torrent, with its trackers and web
+// seeds.
+func FromTorrent(t *torrent.Torrent) *Magnet {
+	m := &Magnet{
+		InfoHash:   t.InfoHash,
+		InfoHashV2: t.InfoHashV2,
+		Name:       t.Name,
+		Length:     t.TotalLength(),
+	}
+	for _, tier := range t.Trackers {
+		m.AddTrackers(tier...)
+	}
+	for _, ws := range t.WebSeeds {
+		m.WebSeeds = appendNew(m.WebSeeds, ws)
+	}
+	return m
+}
+
+// FromStatus returns the magnet URI of a BitTorrent download, from the
+// infoHash and bittorrent keys of aria2.tellStatus.
+func FromStatus(s resp.Status) (*Magnet, error) {
+	if s.InfoHash == "" {
+		return nil, fmt.Errorf("%w: GID#%s is not a BitTorrent download", ErrInvalidMagnet, s.Gid)
+	}
+
+	m := &Magnet{Name: s.BitTorrent.Info.Name}
+	if _, err := m.parseTopic("urn:btih:" + s.InfoHash); err != nil {
+		return nil, err
+	}
+	for _, tier := range s.BitTorrent.AnnounceList {
+		m.AddTrackers(tier...)
+	}
+	return m, nil
+}
+
+// AddTrackers adds the trackers that are not in m yet.
+func (m *Magnet) AddTrackers(urls ...string) {
+	for _, u := range urls {
+		m.Trackers = appendNew(m.Trackers, u)
+	}
+}
+
+// InfoHashHex returns the v1 info hash in lowercase hex, as aria2 reports it
+// in the infoHash key of aria2.tellStatus, or the v2 one if there is none. It
+// identifies the torrent, e.g. to find duplicates.
+func (m *Magnet) InfoHashHex() string {
+	if m.InfoHash == [20]byte{} {
+		return hex.EncodeToString(m.InfoHashV2[:])
+	}
+	return hex.EncodeToString(m.InfoHash[:])
+}
+
+// SelectFile converts SelectOnly to the value of the select-file option of
+// aria2, which counts files from 1. It returns "" if SelectOnly is empty.
+func (m *Magnet) SelectFile() (string, error) {
+	ranges, err := parseRanges(m.SelectOnly)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid so %q", ErrInvalidMagnet, m.SelectOnly)
+	}
+
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		if r[0] == r[1] {
+			parts[i] = strconv.Itoa(r[0] + 1)
+		} else {
+			parts[i] = strconv.Itoa(r[0]+1) + "-" + strconv.Itoa(r[1]+1)
+		}
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// String returns the magnet URI, with the hashes in lowercase hex.
+func (m *Magnet) String() string {
+	var params []string
+	if m.InfoHash != [20]byte{} {
+		params = append(params, "xt=urn:btih:"+hex.EncodeToString(m.InfoHash[:]))
+	}
+	if m.InfoHashV2 != [32]byte{} {
+		params = append(params, "xt=urn:btmh:"+sha256Multihash+hex.EncodeToString(m.InfoHashV2[:]))
+	}
+	if m.Name != "" {
+		params = append(params, "dn="+url.QueryEscape(m.Name))
+	}
+	if m.Length > 0 {
+		params = append(params, "xl="+strconv.FormatInt(m.Length, 10))
+	}
+	for _, tr := range m.Trackers {
+		params = append(params, "tr="+url.QueryEscape(tr))
+	}
+	for _, ws := range m.WebSeeds {
+		params = append(params, "ws="+url.QueryEscape(ws))
+	}
+	if m.SelectOnly != "" {
+		params = append(params, "so="+m.SelectOnly)
+	}
+	return "magnet:?" + strings.Join(params, "&")
+}
+
+// parseRanges parses a list of indexes and ranges, e.g. "0,2-4".
+func parseRanges(s string) ([][2]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var ranges [][2]int
+	for _, part := range strings.Split(s, ",") {
+		lo, hi, isRange := strings.Cut(part, "-")
+		a, err := strconv.Atoi(lo)
+		if err != nil || a < 0 {
+			return nil, fmt.Errorf("invalid index %q", part)
+		}
+		b := a
+		if isRange {
+			if b, err = strconv.Atoi(hi); err != nil || b < a {
+				return nil, fmt.Errorf("invalid range %q", part)
+			}
+		}
+		ranges = append(ranges, [2]int{a, b})
+	}
+	return ranges, nil
+}
+
+func appendNew(list []string, v string) []string {
+	if v == "" || slices.Contains(list, v) {
+		return list
+	}
+	return append(list, v)
+}
@@ -0,0 +1,163 @@
+package magnet_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kahosan/aria2-rpc/magnet"
+	"github.com/kahosan/aria2-rpc/resp"
+	"github.com/kahosan/aria2-rpc/torrent"
+)
+
+const hash = "c12fe1c06bba254a9dc9f519b335aa7c1367a88a"
+
+func TestMagnet(t *testing.T) {
+
+	t.Run("parse", func(t *testing.T) {
+		m, err := magnet.Parse("magnet:?xt=urn:btih:" + strings.ToUpper(hash) +
+			"&dn=Some+File&xl=1024&tr=udp%3A%2F%2Fa.example.com%3A80&tr=http%3A%2F%2Fb.example.com%2Fannounce" +
+			"&tr=udp%3A%2F%2Fa.example.com%3A80&ws=http%3A%2F%2Fseed.example.com%2F&so=0,2-4")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if m.InfoHashHex() != hash || m.Name != "Some File" || m.Length != 1024 || m.SelectOnly != "0,2-4" {
+			t.Fatalf("unexpected magnet %+v", m)
+		}
+		if !reflect.DeepEqual(m.Trackers, []string{"udp://a.example.com:80", "http://b.example.com/announce"}) {
+			t.Fatal("unexpected trackers", m.Trackers)
+		}
+		if !reflect.DeepEqual(m.WebSeeds, []string{"http://seed.example.com/"}) {
+			t.Fatal("unexpected web seeds", m.WebSeeds)
+		}
+
+		sf, err := m.SelectFile()
+		if err != nil || sf != "1,3-5" {
+			t.Fatal("unexpected select-file", sf, err)
+		}
+	})
+
+	t.Run("base32 and numbered parameters", func(t *testing.T) {
+		m, err := magnet.Parse("magnet:?xt.1=urn:btih:YEX6DQDLXISUVHOJ6UM3GNNKPQJWPKEK&tr.1=http://a&tr.2=http://b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.InfoHashHex() != hash || !reflect.DeepEqual(m.Trackers, []string{"http://a", "http://b"}) {
+			t.Fatalf("unexpected magnet %+v", m)
+		}
+	})
+
+	t.Run("more than ten numbered parameters", func(t *testing.T) {
+		uri := "magnet:?xt=urn:btih:" + hash
+		var want []string
+		for i := 1; i <= 12; i++ {
+			tr := fmt.Sprintf("http://tracker%d.example.com/announce", i)
+			uri += fmt.Sprintf("&tr.%d=%s", i, tr)
+			want = append(want, tr)
+		}
+
+		m, err := magnet.Parse(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m.Trackers, want) {
+			t.Fatal("unexpected trackers", m.Trackers)
+		}
+	})
+
+	t.Run("v2", func(t *testing.T) {
+		v2 := strings.Repeat("ab", 32)
+		m, err := magnet.Parse("magnet:?xt=urn:btih:" + hash + "&xt=urn:btmh:1220" + v2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.InfoHashHex() != hash || m.String() != "magnet:?xt=urn:btih:"+hash+"&xt=urn:btmh:1220"+v2 {
+			t.Fatal("unexpected magnet", m)
+		}
+
+		m, err = magnet.Parse("magnet:?xt=urn:btmh:1220" + v2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.InfoHash != [20]byte{} || m.InfoHashHex() != v2 {
+			t.Fatal("unexpected v2 only magnet", m)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, uri := range []string{
+			"http://example.com",
+			"magnet:?dn=name",
+			"magnet:?xt=urn:ed2k:31D6CFE0D16AE931B73C59D7E0C089C0",
+			"magnet:?xt=urn:btih:1234",
+			"magnet:?xt=urn:btmh:1114" + strings.Repeat("ab", 32),
+			"magnet:?xt=urn:btih:" + hash + "&xl=-1",
+			"magnet:?xt=urn:btih:" + hash + "&so=4-2",
+			"magnet:?xt=urn:btih:" + hash + "&dn=%zz",
+		} {
+			if _, err := magnet.Parse(uri); !errors.Is(err, magnet.ErrInvalidMagnet) {
+				t.Fatalf("%s: expected an invalid magnet, got %v", uri, err)
+			}
+		}
+	})
+
+	t.Run("build", func(t *testing.T) {
+		m := &magnet.Magnet{Name: "a b&c", Trackers: []string{"udp://a.example.com:80"}}
+		m.AddTrackers("udp://a.example.com:80", "http://b.example.com/announce")
+
+		parsed, err := magnet.Parse("magnet:?xt=urn:btih:" + hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.InfoHash = parsed.InfoHash
+
+		want := "magnet:?xt=urn:btih:" + hash + "&dn=a+b%26c&tr=udp%3A%2F%2Fa.example.com%3A80&tr=http%3A%2F%2Fb.example.com%2Fannounce"
+		if m.String() != want {
+			t.Fatal("unexpected uri", m.String())
+		}
+
+		again, err := magnet.Parse(m.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m, again) {
+			t.Fatalf("round trip changed the magnet %+v", again)
+		}
+	})
+
+	t.Run("from torrent", func(t *testing.T) {
+		tr := &torrent.Torrent{
+			InfoHash: [20]byte{1, 2, 3},
+			Name:     "file.iso",
+			Files:    []torrent.File{{Index: 1, Path: "file.iso", Length: 42}},
+			Trackers: [][]string{{"http://a", "http://b"}, {"http://a"}},
+			WebSeeds: []string{"http://seed/"},
+		}
+
+		m := magnet.FromTorrent(tr)
+		if m.InfoHashHex() != tr.InfoHashHex() || m.Length != 42 || !reflect.DeepEqual(m.Trackers, []string{"http://a", "http://b"}) {
+			t.Fatalf("unexpected magnet %+v", m)
+		}
+	})
+
+	t.Run("from status", func(t *testing.T) {
+		s := resp.Status{Gid: "2089b05ecca3d829", InfoHash: hash}
+		s.BitTorrent.Info.Name = "file.iso"
+		s.BitTorrent.AnnounceList = [][]string{{"http://a"}, {"http://b"}}
+
+		m, err := magnet.FromStatus(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.String() != "magnet:?xt=urn:btih:"+hash+"&dn=file.iso&tr=http%3A%2F%2Fa&tr=http%3A%2F%2Fb" {
+			t.Fatal("unexpected uri", m.String())
+		}
+
+		if _, err := magnet.FromStatus(resp.Status{Gid: "2089b05ecca3d829"}); !errors.Is(err, magnet.ErrInvalidMagnet) {
+			t.Fatal("expected an error for a download without info hash, got", err)
+		}
+	})
+}
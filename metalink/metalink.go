@@ -0,0 +1,223 @@
+// Package metalink reads and writes Metalink files, the XML lists of mirrors
+// and hashes given to aria2.addMetalink.
+//
+// Metalink 4 (RFC 5854) is read and written. Metalink 3 is read and converted
+// to the types of Metalink 4.
+package metalink
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrInvalidMetalink is returned, wrapped, for a document that is not a valid
+// Metalink.
+var ErrInvalidMetalink = errors.New("invalid metalink")
+
+const (
+	Namespace   = "urn:ietf:params:xml:ns:metalink" // of Metalink 4
+	NamespaceV3 = "http://www.metalinker.org/"
+)
+
+// Metalink is a Metalink 4 document.
+type Metalink struct {
+	XMLName   xml.Name   `xml:"urn:ietf:params:xml:ns:metalink metalink"`
+	Generator string     `xml:"generator,omitempty"`
+	Published *time.Time `xml:"published,omitempty"`
+	Files     []File     `xml:"file"`
+}
+
+// File is a file to download, with its mirrors.
+type File struct {
+	Name        string    `xml:"name,attr"` // relative path of the file
+	Size        int64     `xml:"size,omitempty"`
+	Identity    string    `xml:"identity,omitempty"`
+	Version     string    `xml:"version,omitempty"`
+	Description string    `xml:"description,omitempty"`
+	Languages   []string  `xml:"language"`
+	OS          []string  `xml:"os"`
+	Hashes      []Hash    `xml:"hash"`
+	Pieces      []Pieces  `xml:"pieces"`
+	URLs        []URL     `xml:"url"`
+	MetaURLs    []MetaURL `xml:"metaurl"`
+}
+
+// Hash is the hash of a whole file.
+type Hash struct {
+	Type  string `xml:"type,attr"` // IANA name, e.g. sha-256
+	Value string `xml:",chardata"` // in hex
+}
+
+// Pieces are the hashes of the consecutive pieces of a file.
+type Pieces struct {
+	Length int64    `xml:"length,attr"`
+	Type   string   `xml:"type,attr"`
+	Hashes []string `xml:"hash"`
+}
+
+// URL is a mirror of a file.
+type URL struct {
+	Location string `xml:"location,attr,omitempty"` // ISO 3166-1 country code
+	Priority int    `xml:"priority,attr,omitempty"` // 1 is the highest, 0 if unset
+	URL      string `xml:",chardata"`
+}
+
+// MetaURL is a metadata file describing the file, e.g. a .torrent.
+type MetaURL struct {
+	MediaType string `xml:"mediatype,attr"` // e.g. torrent
+	Priority  int    `xml:"priority,attr,omitempty"`
+	Name      string `xml:"name,attr,omitempty"` // of the file in a multi-file torrent
+	URL       string `xml:",chardata"`
+}
+
+// Parse reads a Metalink 4 or Metalink 3 document.
+func Parse(data []byte) (*Metalink, error) {
+	var root struct {
+		XMLName xml.Name
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMetalink, err)
+	}
+	if root.XMLName.Local != "metalink" {
+		return nil, fmt.Errorf("%w: root element is %s", ErrInvalidMetalink, root.XMLName.Local)
+	}
+
+	m := &Metalink{}
+	switch root.XMLName.Space {
+	case Namespace:
+		if err := xml.Unmarshal(data, m); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidMetalink, err)
+		}
+	case NamespaceV3:
+		var v3 metalink3
+		if err := xml.Unmarshal(data, &v3); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidMetalink, err)
+		}
+		m = v3.convert()
+	default:
+		return nil, fmt.Errorf("%w: unknown namespace %q", ErrInvalidMetalink, root.XMLName.Space)
+	}
+
+	m.trim()
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ParseFile reads the Metalink file name.
+func ParseFile(name string) (*Metalink, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return m, nil
+}
+
+// Marshal returns m as a Metalink 4 document, to be given to AddMetalink.
+func (m *Metalink) Marshal() ([]byte, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// Validate checks the requirements of RFC 5854: each file has a safe relative
+// name and at least one URL or metaurl.
+func (m *Metalink) Validate() error {
+	if len(m.Files) == 0 {
+		return fmt.Errorf("%w: no file", ErrInvalidMetalink)
+	}
+
+	for i, f := range m.Files {
+		clean := path.Clean(f.Name)
+		if f.Name == "" || path.IsAbs(f.Name) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("%w: file %d has an unsafe name %q", ErrInvalidMetalink, i+1, f.Name)
+		}
+		if len(f.URLs) == 0 && len(f.MetaURLs) == 0 {
+			return fmt.Errorf("%w: file %s has no URL", ErrInvalidMetalink, f.Name)
+		}
+	}
+	return nil
+}
+
+// Filter returns a copy of m with the files for which keep returns true.
+func (m *Metalink) Filter(keep func(f File) bool) *Metalink {
+	cp := *m
+	cp.Files = nil
+	for _, f := range m.Files {
+		if keep(f) {
+			cp.Files = append(cp.Files, f)
+		}
+	}
+	return &cp
+}
+
+// Hash returns the hash of the file of the given type, e.g. sha-256, or "".
+func (f *File) Hash(typ string) string {
+	for _, h := range f.Hashes {
+		if h.Type == typ {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// SortedURLs returns the URLs of the file by priority, the ones without a
+// priority last.
+func (f *File) SortedURLs() []URL {
+	urls := slices.Clone(f.URLs)
+	slices.SortStableFunc(urls, func(a, b URL) int {
+		return rank(a.Priority) - rank(b.Priority)
+	})
+	return urls
+}
+
+func rank(priority int) int {
+	if priority <= 0 {
+		return 1 << 30
+	}
+	return priority
+}
+
+// trim removes the spaces around the text values, which XML allows.
+func (m *Metalink) trim() {
+	for i := range m.Files {
+		f := &m.Files[i]
+		for j := range f.Hashes {
+			f.Hashes[j].Value = strings.TrimSpace(f.Hashes[j].Value)
+		}
+		for j := range f.Pieces {
+			for k, h := range f.Pieces[j].Hashes {
+				f.Pieces[j].Hashes[k] = strings.TrimSpace(h)
+			}
+		}
+		for j := range f.URLs {
+			f.URLs[j].URL = strings.TrimSpace(f.URLs[j].URL)
+		}
+		for j := range f.MetaURLs {
+			f.MetaURLs[j].URL = strings.TrimSpace(f.MetaURLs[j].URL)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package metalink_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kahosan/aria2-rpc/metalink"
+)
+
+const v4 = `<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <generator>MirrorBrain/2.17.0</generator>
+  <published>2010-05-01T12:15:02Z</published>
+  <file name="example.ext">
+    <size>14471447</size>
+    <language>en</language>
+    <language>fr</language>
+    <os>Linux-x86</os>
+    <hash type="sha-256">
+      f0ad929cd259957e160ea442eb80986b5f01
+    </hash>
+    <pieces length="262144" type="sha-1">
+      <hash>d96b9a4b92a899c2099b7b31bddb5ca423bb9b30</hash>
+      <hash>10d68f4b6fe4a6fbbde2fe0ea1db4bc2f5e9a4a3</hash>
+    </pieces>
+    <url location="de" priority="1">ftp://ftp.example.com/example.ext</url>
+    <url priority="2">http://example.com/example.ext</url>
+    <url location="fr">http://example.net/example.ext</url>
+    <metaurl mediatype="torrent" priority="1">http://example.com/example.ext.torrent</metaurl>
+  </file>
+  <file name="docs/readme.txt">
+    <url>http://example.com/readme.txt</url>
+  </file>
+</metalink>
+`
+
+const v3 = `<?xml version="1.0" encoding="UTF-8"?>
+<metalink version="3.0" xmlns="http://www.metalinker.org/">
+  <files>
+    <file name="example.ext">
+      <size>14471447</size>
+      <os>Linux-x86</os>
+      <verification>
+        <hash type="sha1">a97fcf6ba9358f8a6f62beee4421863d3e52b080</hash>
+        <pieces length="262144" type="sha1">
+          <hash piece="1">10d68f4b6fe4a6fbbde2fe0ea1db4bc2f5e9a4a3</hash>
+          <hash piece="0">d96b9a4b92a899c2099b7b31bddb5ca423bb9b30</hash>
+        </pieces>
+      </verification>
+      <resources>
+        <url type="ftp" location="US" preference="90">ftp://ftp.example.com/example.ext</url>
+        <url type="http" preference="100">http://example.com/example.ext</url>
+        <url type="bittorrent" preference="100">http://example.com/example.ext.torrent</url>
+        <url type="ed2k">ed2k://|file|example.ext|14471447|hash|/</url>
+      </resources>
+    </file>
+  </files>
+</metalink>
+`
+
+func TestMetalink(t *testing.T) {
+
+	t.Run("parse v4", func(t *testing.T) {
+		m, err := metalink.Parse([]byte(v4))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if m.Generator != "MirrorBrain/2.17.0" || !m.Published.Equal(time.Date(2010, 5, 1, 12, 15, 2, 0, time.UTC)) {
+			t.Fatalf("unexpected metalink %+v", m)
+		}
+		if len(m.Files) != 2 {
+			t.Fatal("unexpected number of files", len(m.Files))
+		}
+
+		f := m.Files[0]
+		if f.Name != "example.ext" || f.Size != 14471447 || !reflect.DeepEqual(f.Languages, []string{"en", "fr"}) || f.OS[0] != "Linux-x86" {
+			t.Fatalf("unexpected file %+v", f)
+		}
+		if f.Hash("sha-256") != "f0ad929cd259957e160ea442eb80986b5f01" || f.Hash("md5") != "" {
+			t.Fatal("unexpected hashes", f.Hashes)
+		}
+		if len(f.Pieces) != 1 || f.Pieces[0].Length != 262144 || len(f.Pieces[0].Hashes) != 2 {
+			t.Fatal("unexpected pieces", f.Pieces)
+		}
+		if f.URLs[0] != (metalink.URL{Location: "de", Priority: 1, URL: "ftp://ftp.example.com/example.ext"}) {
+			t.Fatal("unexpected url", f.URLs[0])
+		}
+		if f.MetaURLs[0] != (metalink.MetaURL{MediaType: "torrent", Priority: 1, URL: "http://example.com/example.ext.torrent"}) {
+			t.Fatal("unexpected metaurl", f.MetaURLs[0])
+		}
+
+		var order []string
+		for _, u := range f.SortedURLs() {
+			order = append(order, u.URL)
+		}
+		if order[0] != "ftp://ftp.example.com/example.ext" || order[2] != "http://example.net/example.ext" {
+			t.Fatal("unexpected url order", order)
+		}
+	})
+
+	t.Run("parse v3", func(t *testing.T) {
+		m, err := metalink.Parse([]byte(v3))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f := m.Files[0]
+		if f.Hash("sha-1") != "a97fcf6ba9358f8a6f62beee4421863d3e52b080" {
+			t.Fatal("unexpected hashes", f.Hashes)
+		}
+		if p := f.Pieces[0]; p.Type != "sha-1" || p.Hashes[0] != "d96b9a4b92a899c2099b7b31bddb5ca423bb9b30" {
+			t.Fatal("unexpected pieces", f.Pieces)
+		}
+
+		want := []metalink.URL{
+			{Location: "us", Priority: 11, URL: "ftp://ftp.example.com/example.ext"},
+			{Priority: 1, URL: "http://example.com/example.ext"},
+		}
+		if !reflect.DeepEqual(f.URLs, want) {
+			t.Fatalf("unexpected urls %+v", f.URLs)
+		}
+		if len(f.MetaURLs) != 1 || f.MetaURLs[0].MediaType != "torrent" {
+			t.Fatalf("unexpected metaurls %+v", f.MetaURLs)
+		}
+	})
+
+	t.Run("marshal", func(t *testing.T) {
+		published := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		m := &metalink.Metalink{
+			Generator: "ci",
+			Published: &published,
+			Files: []metalink.File{{
+				Name:   "app.tar.gz",
+				Size:   42,
+				Hashes: []metalink.Hash{{Type: "sha-256", Value: "abcd"}},
+				URLs: []metalink.URL{
+					{Location: "jp", Priority: 1, URL: "https://jp.example.com/app.tar.gz?a=1&b=2"},
+					{URL: "https://example.com/app.tar.gz"},
+				},
+			}},
+		}
+
+		data, err := m.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := string(data)
+		if !strings.HasPrefix(s, "<?xml") || !strings.Contains(s, `<metalink xmlns="urn:ietf:params:xml:ns:metalink">`) ||
+			!strings.Contains(s, `<url location="jp" priority="1">https://jp.example.com/app.tar.gz?a=1&amp;b=2</url>`) {
+			t.Fatalf("unexpected document:\n%s", s)
+		}
+		t.Log(s)
+
+		again, err := metalink.Parse(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again.XMLName = m.XMLName
+		if !reflect.DeepEqual(m, again) {
+			t.Fatalf("round trip changed the metalink %+v", again)
+		}
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		m, err := metalink.Parse([]byte(v4))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		docs := m.Filter(func(f metalink.File) bool { return strings.HasPrefix(f.Name, "docs/") })
+		if len(docs.Files) != 1 || len(m.Files) != 2 {
+			t.Fatal("unexpected filtered files", docs.Files)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, doc := range []string{
+			"not xml",
+			`<feed xmlns="http://www.w3.org/2005/Atom"/>`,
+			`<metalink xmlns="urn:example"/>`,
+			`<metalink xmlns="urn:ietf:params:xml:ns:metalink"/>`,
+			`<metalink xmlns="urn:ietf:params:xml:ns:metalink"><file name="a"/></metalink>`,
+			`<metalink xmlns="urn:ietf:params:xml:ns:metalink"><file name="../etc/passwd"><url>http://x</url></file></metalink>`,
+			`<metalink xmlns="urn:ietf:params:xml:ns:metalink"><file name="/etc/passwd"><url>http://x</url></file></metalink>`,
+		} {
+			if _, err := metalink.Parse([]byte(doc)); !errors.Is(err, metalink.ErrInvalidMetalink) {
+				t.Fatalf("%s: expected an invalid metalink, got %v", doc, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package metalink
+
+import (
+	"slices"
+	"strings"
+)
+
+// metalink3 is a Metalink 3 document.
+//
+// see: http://www.metalinker.org/Metalink_3.0_Spec.pdf
+type metalink3 struct {
+	Generator string  `xml:"generator"`
+	Files     []file3 `xml:"files>file"`
+}
+
+type file3 struct {
+	Name        string    `xml:"name,attr"`
+	Size        int64     `xml:"size"`
+	Identity    string    `xml:"identity"`
+	Version     string    `xml:"version"`
+	Description string    `xml:"description"`
+	Languages   []string  `xml:"language"`
+	OS          []string  `xml:"os"`
+	Hashes      []Hash    `xml:"verification>hash"`
+	Pieces      []pieces3 `xml:"verification>pieces"`
+	URLs        []url3    `xml:"resources>url"`
+}
+
+type pieces3 struct {
+	Length int64        `xml:"length,attr"`
+	Type   string       `xml:"type,attr"`
+	Hashes []pieceHash3 `xml:"hash"`
+}
+
+type pieceHash3 struct {
+	Piece int    `xml:"piece,attr"`
+	Value string `xml:",chardata"`
+}
+
+type url3 struct {
+	Type       string `xml:"type,attr"`
+	Location   string `xml:"location,attr"`
+	Preference int    `xml:"preference,attr"` // 100 is the highest
+	URL        string `xml:",chardata"`
+}
+
+// hashTypes maps the hash names of Metalink 3 to the IANA names of Metalink 4.
+var hashTypes = map[string]string{
+	"sha1":   "sha-1",
+	"sha224": "sha-224",
+	"sha256": "sha-256",
+	"sha384": "sha-384",
+	"sha512": "sha-512",
+}
+
+func hashType(t string) string {
+	t = strings.ToLower(t)
+	if v, ok := hashTypes[t]; ok {
+		return v
+	}
+	return t
+}
+
+func (v3 *metalink3) convert() *Metalink {
+	m := &Metalink{Generator: v3.Generator}
+
+	for _, f3 := range v3.Files {
+		f := File{
+			Name:        f3.Name,
+			Size:        f3.Size,
+			Identity:    f3.Identity,
+			Version:     f3.Version,
+			Description: f3.Description,
+			Languages:   f3.Languages,
+			OS:          f3.OS,
+		}
+
+		for _, h := range f3.Hashes {
+			f.Hashes = append(f.Hashes, Hash{Type: hashType(h.Type), Value: h.Value})
+		}
+
+		for _, p3 := range f3.Pieces {
+			hashes := slices.Clone(p3.Hashes)
+			slices.SortStableFunc(hashes, func(a, b pieceHash3) int { return a.Piece - b.Piece })
+
+			p := Pieces{Length: p3.Length, Type: hashType(p3.Type)}
+			for _, h := range hashes {
+				p.Hashes = append(p.Hashes, h.Value)
+			}
+			f.Pieces = append(f.Pieces, p)
+		}
+
+		for _, u := range f3.URLs {
+			// the preference of Metalink 3 goes up to 100, the priority of
+			// Metalink 4 starts at 1
+			priority := 0
+			if u.Preference > 0 {
+				priority = max(101-u.Preference, 1)
+			}
+
+			switch strings.ToLower(u.Type) {
+			case "bittorrent":
+				f.MetaURLs = append(f.MetaURLs, MetaURL{MediaType: "torrent", Priority: priority, URL: u.URL})
+			case "http", "https", "ftp", "ftps", "":
+				f.URLs = append(f.URLs, URL{Location: strings.ToLower(u.Location), Priority: priority, URL: u.URL})
+			}
+		}
+
+		m.Files = append(m.Files, f)
+	}
+	return m
+}
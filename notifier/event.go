@@ -0,0 +1,75 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/kahosan/aria2-rpc/resp"
+)
+
+// EventKind is the kind of a notification, one per method of NotifyEvents.
+type EventKind int
+
+const (
+	KindUnknown    EventKind = iota // a method that is not in NotifyEvents
+	KindStart                       // aria2.onDownloadStart
+	KindPause                       // aria2.onDownloadPause
+	KindStop                        // aria2.onDownloadStop
+	KindComplete                    // aria2.onDownloadComplete
+	KindError                       // aria2.onDownloadError
+	KindBtComplete                  // aria2.onBtDownloadComplete
+)
+
+var methodKinds = map[string]EventKind{
+	NotifyEvents.Start:      KindStart,
+	NotifyEvents.Pause:      KindPause,
+	NotifyEvents.Stop:       KindStop,
+	NotifyEvents.Complete:   KindComplete,
+	NotifyEvents.Error:      KindError,
+	NotifyEvents.BtComplete: KindBtComplete,
+}
+
+// KindOf returns the kind of the notification method, KindUnknown if it is
+// not in NotifyEvents.
+func KindOf(method string) EventKind {
+	return methodKinds[method]
+}
+
+func (k EventKind) String() string {
+	switch k {
+	case KindStart:
+		return "start"
+	case KindPause:
+		return "pause"
+	case KindStop:
+		return "stop"
+	case KindComplete:
+		return "complete"
+	case KindError:
+		return "error"
+	case KindBtComplete:
+		return "btComplete"
+	}
+	return "unknown"
+}
+
+// Event is a notification of aria2 for a download.
+type Event struct {
+	Gid       string          `json:"gid"`
+	Method    string          `json:"-"` // e.g. aria2.onDownloadStart
+	Kind      EventKind       `json:"-"`
+	Time      time.Time       `json:"-"` // when it was received, or emitted if synthetic
+	SessionID string          `json:"-"` // the session of aria2 it was received from, if known
+	Synthetic bool            `json:"-"` // emitted after a reconnection or a poll, aria2 did not send it
+	Params    json.RawMessage `json:"-"` // the params of the notification, for a method of KindUnknown
+	Status    *resp.Status    `json:"-"` // fetched after the event when enriched, see Enrich
+	StatusErr error           `json:"-"` // why Status could not be fetched
+}
+
+// SessionFunc returns the session ID of aria2, as aria2.getSessionInfo does.
+type SessionFunc func(ctx context.Context) (string, error)
+
+// StatusFunc returns the given keys of the status of a download, as
+// aria2.tellStatus does.
+type StatusFunc func(ctx context.Context, gid string, keys ...string) (resp.Status, error)
@@ -0,0 +1,95 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is a panic of the handler of a subscription.
+type PanicError struct {
+	Event Event // the event the handler was called with
+	Value any   // the value passed to panic
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("notifier: handler panicked on %s %s: %v", e.Event.Method, e.Event.Gid, e.Value)
+}
+
+// Handle calls fn with the events that match opts, one at a time in a
+// dedicated goroutine, until ctx ends, Unsubscribe is called or the Notify is
+// closed. The events still buffered then are discarded, but a call may be in
+// progress when Unsubscribe returns: fn returned for the last time once Done
+// is closed, which fn itself must not wait for.
+func (n *Notify) Handle(ctx context.Context, fn func(e Event), opts ...SubscribeOption) *Subscription {
+	s := n.l.b.subscribe(opts, true)
+	go s.run(ctx, fn, false)
+	return s
+}
+
+// HandleOnce calls fn with the first event that matches opts, then ends the
+// subscription.
+func (n *Notify) HandleOnce(ctx context.Context, fn func(e Event), opts ...SubscribeOption) *Subscription {
+	s := n.l.b.subscribe(opts, true)
+	go s.run(ctx, fn, true)
+	return s
+}
+
+// run calls fn with the events until the subscription ends.
+func (s *Subscription) run(ctx context.Context, fn func(e Event), once bool) {
+	defer close(s.finished)
+
+	for {
+		select {
+		case e, ok := <-s.ch:
+			if !ok {
+				return
+			}
+			// the subscription may have ended while e was buffered
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+
+			if !s.call(fn, e) {
+				return
+			}
+			if once {
+				s.Unsubscribe()
+				return
+			}
+		case <-s.done:
+			return
+		case <-ctx.Done():
+			s.stop(ctx.Err())
+			s.b.remove(s)
+			return
+		}
+	}
+}
+
+// call calls fn and recovers from its panic. It reports whether the
+// subscription goes on.
+func (s *Subscription) call(fn func(e Event), e Event) (ok bool) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+
+		err := &PanicError{Event: e, Value: v, Stack: debug.Stack()}
+		if s.cfg.onPanic != nil {
+			s.cfg.onPanic(err)
+			ok = true
+			return
+		}
+		s.stop(err)
+		s.b.remove(s)
+		ok = false
+	}()
+
+	fn(e)
+	return true
+}
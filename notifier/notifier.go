@@ -2,24 +2,19 @@ package notifier
 
 import (
 	"context"
-	"io"
-	"log"
+	"encoding/json"
+	"errors"
+	"maps"
 	"net/url"
 	"reflect"
+	"slices"
 	"sync"
+	"time"
 
-	"github.com/gorilla/websocket"
+	"github.com/kahosan/aria2-rpc/internal/caller"
+	"github.com/kahosan/aria2-rpc/resp"
 )
 
-type reply struct {
-	Method string  `json:"method"`
-	Params []Event `json:"params"`
-}
-
-type Event struct {
-	Gid string `json:"gid"`
-}
-
 type Tasks = map[string]func(gid string)
 
 type ne struct {
@@ -31,12 +26,37 @@ type ne struct {
 	BtComplete string
 }
 
+// Snapshot returns the status of every download known to aria2, only the gid
+// and status keys are needed. It is used to rebuild the transitions missed
+// while the connection was down.
+type Snapshot func(ctx context.Context) ([]resp.Status, error)
+
+// Gap describes a period during which the connection to aria2 was down, or
+// aria2 could not be polled, and notifications may have been missed.
+type Gap struct {
+	From       time.Time // when the connection was lost
+	To         time.Time // when the connection was re-established
+	Err        error     // why notifications were missed, caller.ErrDisconnected or the error of the first failed poll
+	Reconciled bool      // whether the missed transitions were emitted as synthetic events
+}
+
+// DefaultPollInterval is the default polling period of a polling notifier.
+const DefaultPollInterval = time.Second
+
 type notifier struct {
-	host *url.URL
+	host     *url.URL
+	caller   *caller.Caller
+	opts     *caller.Options
+	snapshot Snapshot
+	interval time.Duration // polling period, if the notifications may be polled
+	polling  bool          // poll instead of receiving the notifications
+	session  SessionFunc
+	status   StatusFunc
+	keys     []string
 }
 
 type Notify struct {
-	r     *sync.Map
+	l     *listener
 	Close func()
 }
 
@@ -49,106 +69,633 @@ var NotifyEvents = &ne{
 	BtComplete: "aria2.onBtDownloadComplete",
 }
 
-func NewNotifier(host *url.URL) *notifier {
-	return &notifier{
-		host,
+// NewNotifier returns a notifier for the aria2 at host. Notifications are
+// received on the WebSocket connection of c, or on a dedicated one dialed with
+// opts if c is nil or an HTTP caller. If snapshot is not nil, the
+// notifications missed while the connection was down are emitted as synthetic
+// events once it is re-established.
+func NewNotifier(host *url.URL, c *caller.Caller, opts *caller.Options, snapshot Snapshot) *notifier {
+	return &notifier{host: host, caller: c, opts: opts, snapshot: snapshot}
+}
+
+// NewPollingNotifier returns a notifier that takes a snapshot of the
+// downloads every interval, DefaultPollInterval if zero, instead of receiving
+// the notifications of aria2, for the deployments that do not allow WebSocket
+// connections. It emits the events aria2 would have sent, but only for the
+// transitions seen between two snapshots: a download that starts and
+// completes in between only emits a Complete event.
+func NewPollingNotifier(snapshot Snapshot, interval time.Duration) *notifier {
+	return &notifier{snapshot: snapshot, interval: interval, polling: true}
+}
+
+// Fallback makes Listener poll as NewPollingNotifier does, when the dedicated
+// WebSocket connection cannot be established, e.g. behind an HTTP gateway
+// that refuses the upgrade.
+func (n *notifier) Fallback(interval time.Duration) *notifier {
+	if interval <= 0 {
+		interval = DefaultPollInterval
 	}
+	n.interval = interval
+	return n
 }
 
+// Session sets the function that returns the session ID of aria2, it is
+// fetched when the listener starts and after each reconnection, and set on
+// the events.
+func (n *notifier) Session(fn SessionFunc) *notifier {
+	n.session = fn
+	return n
+}
+
+// Enrich makes the listener fetch the given keys of the status of the
+// download of each event, all of them if none, before sending it to the
+// Events channel. The other channels are not delayed.
+func (n *notifier) Enrich(fn StatusFunc, keys ...string) *notifier {
+	n.status, n.keys = fn, keys
+	return n
+}
+
+// Listener starts receiving notifications until c ends or Close is called.
+// When the connection is lost, the caller reconnects on its own and the
+// outage is reported on the Gaps channel.
 func (n *notifier) Listener(c context.Context) (*Notify, error) {
-	switch n.host.Scheme {
-	case "https", "wss":
-		n.host.Scheme = "wss"
-	case "http", "ws":
-		n.host.Scheme = "ws"
+	if n.polling {
+		return n.poll(c)
 	}
 
-	conn, _, err := websocket.DefaultDialer.Dial(n.host.String(), nil)
-	if err != nil {
-		return nil, err
+	rpc, own := n.caller, false
+	if rpc == nil || rpc.Subscribe == nil {
+		host := *n.host
+		switch host.Scheme {
+		case "https", "wss":
+			host.Scheme = "wss"
+		case "http", "ws":
+			host.Scheme = "ws"
+		}
+
+		var err error
+		if rpc, err = caller.NewCaller(&host, n.opts); err != nil {
+			if n.interval <= 0 {
+				return nil, err
+			}
+			notify, perr := n.poll(c)
+			if perr != nil {
+				return nil, errors.Join(err, perr)
+			}
+			return notify, nil
+		}
+		own = true
 	}
 
-	r := sync.Map{}
 	ctx, cancel := context.WithCancel(c)
+	l := n.newListener(ctx)
 
-	// create channels for each method, and store them in the map
-	values := reflect.ValueOf(*NotifyEvents)
-	for i := 0; i < values.NumField(); i++ {
-		r.Store(values.Field(i).String(), make(chan string, 10))
+	unsubscribe := rpc.Subscribe(l.receive)
+	unregister := rpc.OnStateChange(func(s caller.State) { l.stateChange(ctx, s) })
+	l.refreshSession(ctx)
+	l.reconcile(ctx, false)
+
+	go func() {
+		<-ctx.Done()
+		unsubscribe()
+		unregister()
+		if own {
+			rpc.Close()
+		}
+		l.close()
+	}()
+
+	return &Notify{
+		l,
+		cancel,
+	}, nil
+}
+
+// poll starts taking a snapshot every interval, and emits the transitions
+// since the previous one. A failed snapshot is reported on the Gaps channel
+// once one succeeds again.
+func (n *notifier) poll(c context.Context) (*Notify, error) {
+	interval := n.interval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	ctx, cancel := context.WithCancel(c)
+	l := n.newListener(ctx)
+	l.refreshSession(ctx)
+	if err := l.reconcile(ctx, false); err != nil {
+		cancel()
+		l.close()
+		return nil, err
 	}
 
 	go func() {
-		defer func() {
-			r.Range(func(key, value any) bool {
-				close(value.(chan string))
-				return true
-			})
-			conn.Close()
-		}()
+		defer l.close()
 
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var gap *Gap
 		for {
 			select {
+			case <-ticker.C:
 			case <-ctx.Done():
 				return
-			default:
-			}
-
-			resp := &reply{}
-			// read notifications from the connection
-			if err := conn.ReadJSON(resp); err != nil {
-				if err == io.ErrUnexpectedEOF {
-					log.Println("unexpected EOF | if you are using nginx, please adjust the value of `proxy_read_timeout`")
-					return
-				}
-				log.Printf("reading websocket message: %v", err)
-				return
 			}
 
-			for _, event := range resp.Params {
-				// created channels for all methods in advance
-				ch, _ := r.Load(resp.Method)
-				select {
-				case ch.(chan string) <- event.Gid:
-				default:
-					// if the channel is full, skip the event, maybe the corresponding subscription does not exist
-				}
+			err := l.reconcile(ctx, true)
+			switch {
+			case err != nil && gap == nil:
+				gap = &Gap{From: time.Now(), Err: err}
+			case err == nil && gap != nil:
+				// aria2 may have been restarted meanwhile
+				l.refreshSession(ctx)
+				gap.To, gap.Reconciled = time.Now(), true
+				l.report(*gap)
+				gap = nil
 			}
 		}
 	}()
 
 	return &Notify{
-		&r,
+		l,
 		cancel,
 	}, nil
 }
 
-func (n *Notify) notifyFunc(method string) <-chan string {
-	ch, _ := n.r.Load(method)
-	return ch.(chan string)
+// newListener creates the channels of each method, and starts dispatching
+// the events, enriched if enabled.
+func (n *notifier) newListener(ctx context.Context) *listener {
+	r := &sync.Map{}
+	values := reflect.ValueOf(*NotifyEvents)
+	for i := 0; i < values.NumField(); i++ {
+		r.Store(values.Field(i).String(), make(chan string, 10))
+	}
+
+	l := &listener{
+		snapshot:    n.snapshot,
+		session:     n.session,
+		r:           r,
+		gaps:        make(chan Gap, 10),
+		events:      make(chan Event, 10),
+		unknown:     make(chan Event, 10),
+		b:           newBroker(),
+		wake:        make(chan struct{}, 1),
+		known:       make(map[string]state),
+		reconciling: true,
+	}
+
+	go l.pump(ctx, n.status, n.keys)
+	return l
 }
 
-func (n *Notify) ListenMultiple(events map[string]func(gid string)) {
-	for method, fn := range events {
-		go func(m string, f func(gid string)) {
-			for gid := range n.notifyFunc(m) {
-				f(gid)
-			}
-		}(method, fn)
+// state is the last known state of a download, as implied by the events.
+type state int
+
+const (
+	stateUnknown state = iota
+	stateActive
+	stateSeeding
+	statePaused
+	stateWaiting
+	stateComplete
+	stateError
+	stateRemoved
+)
+
+var errNoSnapshot = errors.New("no snapshot function")
+
+// maxFinal is the number of downloads in a final state that a listener
+// remembers, as many as aria2 keeps by default, see --max-download-result.
+const maxFinal = 1000
+
+func (s state) final() bool {
+	return s == stateComplete || s == stateError || s == stateRemoved
+}
+
+var eventStates = map[string]state{
+	NotifyEvents.Start:      stateActive,
+	NotifyEvents.Pause:      statePaused,
+	NotifyEvents.Stop:       stateRemoved,
+	NotifyEvents.Complete:   stateComplete,
+	NotifyEvents.Error:      stateError,
+	NotifyEvents.BtComplete: stateSeeding,
+}
+
+type listener struct {
+	snapshot Snapshot
+	session  SessionFunc
+	r        *sync.Map // the channel of each method
+	gaps     chan Gap
+	events   chan Event
+	unknown  chan Event
+	b        *broker
+	wake     chan struct{} // signals the events queued for pump
+
+	mu          sync.Mutex
+	sessionID   string
+	known       map[string]state
+	final       []string  // the downloads that entered a final state, oldest first
+	from        time.Time // when the connection was lost
+	reconciling bool      // notifications are queued in pending meanwhile
+	pending     []Event
+	queued      []Event // the events to dispatch
+	closed      bool
+}
+
+// receive is called with the notifications pushed by aria2.
+func (l *listener) receive(method string, params json.RawMessage) {
+	now, kind := time.Now(), KindOf(method)
+
+	var events []Event
+	if err := json.Unmarshal(params, &events); err != nil || len(events) == 0 {
+		if kind != KindUnknown {
+			return
+		}
+		// still report the notifications of unknown methods
+		events = []Event{{}}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, e := range events {
+		e.Method, e.Kind, e.Time = method, kind, now
+		if kind == KindUnknown {
+			e.Params = params
+		}
+
+		if l.reconciling {
+			l.pending = append(l.pending, e)
+			continue
+		}
+		l.deliverLocked(e)
+	}
+}
+
+func (l *listener) deliverLocked(e Event) {
+	s, ok := eventStates[e.Method]
+	// skip the duplicates of the synthetic events emitted after a reconnection
+	if ok && l.known[e.Gid] == s && s != stateActive {
+		return
+	}
+	if ok {
+		l.setLocked(e.Gid, s)
+	}
+	l.emitLocked(e)
+}
+
+// setLocked records the state of gid. When more than twice maxFinal
+// downloads in a final state are remembered, only the latest maxFinal are
+// kept: aria2 purged the others unless configured otherwise, in which case
+// reconcile may emit their synthetic events again.
+func (l *listener) setLocked(gid string, s state) {
+	l.known[gid] = s
+	if !s.final() {
+		return
+	}
+
+	l.final = append(l.final, gid)
+	if len(l.final) <= 2*maxFinal {
+		return
+	}
+
+	// keep the latest entry of the downloads that were not purged meanwhile
+	seen := make(map[string]bool, len(l.final))
+	var kept []string
+	for _, g := range slices.Backward(l.final) {
+		if !seen[g] && l.known[g].final() {
+			kept = append(kept, g)
+		}
+		seen[g] = true
+	}
+	for _, g := range kept[min(len(kept), maxFinal):] {
+		delete(l.known, g)
+	}
+	kept = kept[:min(len(kept), maxFinal)]
+	slices.Reverse(kept)
+	l.final = kept
+}
+
+// refreshSession fetches the session ID of aria2, which changes when it is
+// restarted. It is kept if it cannot be fetched.
+func (l *listener) refreshSession(ctx context.Context) {
+	if l.session == nil {
+		return
+	}
+	id, err := l.session(ctx)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	l.sessionID = id
+	l.mu.Unlock()
+}
+
+func (l *listener) stateChange(ctx context.Context, s caller.State) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch s {
+	case caller.StateDisconnected:
+		l.from = time.Now()
+	case caller.StateConnected:
+		// the snapshot needs a call, which must not be made from the hook
+		l.reconciling = true
+		from := l.from
+		go func() {
+			gap := Gap{From: from, To: time.Now(), Err: caller.ErrDisconnected}
+			l.refreshSession(ctx)
+			gap.Reconciled = l.reconcile(ctx, true) == nil
+			l.report(gap)
+		}()
+	}
+}
+
+// report sends gap to the Gaps channel, unless it is full or closed.
+func (l *listener) report(gap Gap) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return
+	}
+	select {
+	case l.gaps <- gap:
+	default:
+	}
+}
+
+// reconcile takes a snapshot of the downloads and compares it with the known
+// states. If emit is true, synthetic events are emitted for the transitions
+// that happened in between, otherwise the snapshot is only recorded. It
+// returns the error of the snapshot, if it could not be taken.
+func (l *listener) reconcile(ctx context.Context, emit bool) error {
+	var list []resp.Status
+	err := errNoSnapshot
+	if l.snapshot != nil {
+		list, err = l.snapshot(ctx)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// deliver the notifications received in the meantime, they are newer
+	defer func() {
+		for _, e := range l.pending {
+			l.deliverLocked(e)
+		}
+		l.pending = nil
+		l.reconciling = false
+	}()
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	synthetic := func(method, gid string) Event {
+		return Event{Gid: gid, Method: method, Kind: KindOf(method), Time: now, Synthetic: true}
+	}
+
+	var events []Event
+	seen := make(map[string]bool, len(list))
+	for _, s := range list {
+		seen[s.Gid] = true
+		prev, cur := l.known[s.Gid], snapshotState(s)
+		if prev == cur || (prev == stateSeeding && cur == stateActive) {
+			continue
+		}
+		l.setLocked(s.Gid, cur)
+
+		if method := transition(cur); method != "" {
+			events = append(events, synthetic(method, s.Gid))
+		}
+	}
+
+	// downloads that are no longer known to aria2 were removed and purged
+	for gid, prev := range l.known {
+		if seen[gid] {
+			continue
+		}
+		delete(l.known, gid)
+
+		if !prev.final() {
+			events = append(events, synthetic(NotifyEvents.Stop, gid))
+		}
+	}
+
+	if emit {
+		for _, e := range events {
+			l.emitLocked(e)
+		}
+	}
+	return nil
+}
+
+func snapshotState(s resp.Status) state {
+	switch s.Status {
+	case resp.StatusActive:
+		if s.Seeder {
+			return stateSeeding
+		}
+		return stateActive
+	case resp.StatusWaiting:
+		return stateWaiting
+	case resp.StatusPaused:
+		return statePaused
+	case resp.StatusComplete:
+		return stateComplete
+	case resp.StatusError:
+		return stateError
+	case resp.StatusRemoved:
+		return stateRemoved
+	}
+	return stateUnknown
+}
+
+// transition returns the notification aria2 sends when a download enters s,
+// or "" if there is none.
+func transition(s state) string {
+	switch s {
+	case stateActive:
+		return NotifyEvents.Start
+	case stateSeeding:
+		return NotifyEvents.BtComplete
+	case statePaused:
+		return NotifyEvents.Pause
+	case stateComplete:
+		return NotifyEvents.Complete
+	case stateError:
+		return NotifyEvents.Error
+	case stateRemoved:
+		return NotifyEvents.Stop
 	}
+	return ""
 }
 
-func (n *Notify) ListenOnce(method string, fn func(gid string, stop func())) {
-	ch := n.notifyFunc(method)
+func (l *listener) emitLocked(e Event) {
+	if l.closed {
+		return
+	}
+	e.SessionID = l.sessionID
+
+	if ch, ok := l.r.Load(e.Method); ok {
+		select {
+		case ch.(chan string) <- e.Gid:
+		default:
+			// if the channel is full, skip the event, maybe the corresponding subscription does not exist
+		}
+	}
+
+	// dispatched by pump, the subscriptions may block
+	l.queued = append(l.queued, e)
+	l.signal()
+}
 
-	done := false
-	stop := func() { done = true }
+func (l *listener) signal() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
 
-	for gid := range ch {
-		if done {
+// dispatch sends e to the Events channel, to the Unknown one if its method is
+// unknown, and to the subscriptions.
+func (l *listener) dispatch(e Event) {
+	select {
+	case l.events <- e:
+	default:
+	}
+	if e.Kind == KindUnknown {
+		select {
+		case l.unknown <- e:
+		default:
+		}
+	}
+	l.b.publish(e)
+}
+
+// pump dispatches the queued events in order, after fetching the status of
+// their download if status is not nil. It closes the event channels and the
+// subscriptions once the listener is closed and the queue is drained.
+func (l *listener) pump(ctx context.Context, status StatusFunc, keys []string) {
+	defer l.b.close()
+	defer close(l.unknown)
+	defer close(l.events)
+
+	for {
+		l.mu.Lock()
+		queued, closed := l.queued, l.closed
+		l.queued = nil
+		l.mu.Unlock()
+
+		for _, e := range queued {
+			if status != nil && e.Gid != "" {
+				s, err := status(ctx, e.Gid, keys...)
+				if err != nil {
+					e.StatusErr = err
+				} else {
+					e.Status = &s
+				}
+			}
+			l.dispatch(e)
+		}
+
+		if closed {
 			return
 		}
-		fn(gid, stop)
+		if len(queued) == 0 {
+			<-l.wake
+		}
+	}
+}
+
+// channel returns the channel of method, created if it is not in NotifyEvents.
+func (l *listener) channel(method string) chan string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if ch, ok := l.r.Load(method); ok {
+		return ch.(chan string)
+	}
+
+	ch := make(chan string, 10)
+	if l.closed {
+		close(ch)
+		return ch
 	}
+	l.r.Store(method, ch)
+	return ch
+}
+
+// close closes the channels, once no more events can be emitted on them.
+func (l *listener) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	l.r.Range(func(key, value any) bool {
+		close(value.(chan string))
+		return true
+	})
+	close(l.gaps)
+
+	// pump closes the event channels once the queued events are dispatched
+	l.b.interrupt()
+	l.signal()
+}
+
+func (n *Notify) notifyFunc(method string) <-chan string {
+	return n.l.channel(method)
+}
+
+// ListenMultiple calls the function of each method with the gid of its
+// events, until the returned subscription ends. See Handle.
+func (n *Notify) ListenMultiple(events map[string]func(gid string)) *Subscription {
+	methods := slices.Collect(maps.Keys(events))
+	return n.Handle(context.Background(), func(e Event) {
+		if fn, ok := events[e.Method]; ok {
+			fn(e.Gid)
+		}
+	}, WithMethods(methods...))
+}
+
+// ListenOnce calls fn with the gid of the events of method until stop is
+// called, fn then is not called anymore, or the Notify is closed. A panic of
+// fn also ends it, and is returned as a *PanicError.
+func (n *Notify) ListenOnce(method string, fn func(gid string, stop func())) error {
+	s := n.l.b.subscribe([]SubscribeOption{WithMethods(method)}, true)
+	s.run(context.Background(), func(e Event) { fn(e.Gid, s.Unsubscribe) }, false)
+	return s.Err()
+}
+
+// Events returns a channel that receives every event, with the method,
+// the time and the session ID of aria2, and the status of the download if
+// enriched.
+func (n *Notify) Events() <-chan Event {
+	return n.l.events
+}
+
+// Unknown returns a channel that receives the events of the methods that are
+// not in NotifyEvents.
+func (n *Notify) Unknown() <-chan Event {
+	return n.l.unknown
+}
+
+// Subscribe returns a subscription to the events, with its own buffer. Unlike
+// the channels of the methods, which are shared by their readers, each
+// subscription receives every event that matches its filters.
+func (n *Notify) Subscribe(opts ...SubscribeOption) *Subscription {
+	return n.l.b.subscribe(opts, false)
+}
+
+// Gaps returns a channel that receives a Gap each time the connection was
+// lost and re-established, or when polling, each time aria2 could be polled
+// again after failed attempts.
+func (n *Notify) Gaps() <-chan Gap {
+	return n.l.gaps
 }
 
 func (n *Notify) Start() <-chan string {
@@ -2,25 +2,31 @@ package notifier_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
 	"sync"
 	"testing"
 	"time"
 
 	ario "github.com/kahosan/aria2-rpc"
-	"github.com/kahosan/aria2-rpc/internal/testutils"
+	"github.com/kahosan/aria2-rpc/ariotest"
 	"github.com/kahosan/aria2-rpc/notifier"
+	"github.com/kahosan/aria2-rpc/resp"
 )
 
 func TestNotifyListener(t *testing.T) {
+	srv := ariotest.NewServer()
+	defer srv.Close()
 
 	t.Run("if notify is false, the listener will not be created", func(t *testing.T) {
-		_, err := ario.NewClient(testutils.Arai2Uri("https://"), "", false)
+		_, err := ario.NewClient(srv.URL, "", false)
 		if err != nil {
 			t.Fatal("should error")
 		}
 	})
 
-	client, err := ario.NewClient(testutils.Arai2Uri("https://"), "", true)
+	client, err := ario.NewClient(srv.URL, "", true)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -197,4 +203,684 @@ func TestNotifyListener(t *testing.T) {
 
 		wg.Wait()
 	})
+
+	t.Run("missed events are emitted after reconnecting", func(t *testing.T) {
+		notify, err := client.NotifyListener(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer notify.Close()
+
+		gid, err := client.AddURI([]string{"https://releases.ubuntu.com/22.04.2/ubuntu-22.04.2-live-server-amd64.iso"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// let the listener record the download as active
+		select {
+		case <-notify.Start():
+		case <-time.After(5 * time.Second):
+			t.Fatal("no start event")
+		}
+
+		srv.CloseConnections()
+		if err := srv.Complete(gid); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case gap := <-notify.Gaps():
+			if !gap.Reconciled {
+				t.Fatal("gap should be reconciled")
+			}
+			t.Log("reconnected after: ", gap.To.Sub(gap.From), gap.Err)
+		case <-time.After(10 * time.Second):
+			t.Fatal("no gap reported")
+		}
+
+		select {
+		case g := <-notify.Complete():
+			if g != gid {
+				t.Fatal("unexpected gid: ", g)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("missed complete event was not emitted")
+		}
+	})
+
+	t.Run("only the latest downloads in a final state are remembered", func(t *testing.T) {
+		notify, err := client.NotifyListener(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer notify.Close()
+
+		const first = "0000000000000001"
+		sub := notify.Subscribe(notifier.WithGIDs(first))
+		all := notify.Subscribe(notifier.WithBuffer(3000))
+
+		complete := func(gids ...string) {
+			t.Helper()
+			for _, gid := range gids {
+				srv.Notify(notifier.NotifyEvents.Complete, gid)
+			}
+			// wait until they are dispatched, the duplicates are not
+			for range slices.Compact(slices.Clone(gids)) {
+				select {
+				case <-all.Events():
+				case <-time.After(5 * time.Second):
+					t.Fatal("no event")
+				}
+			}
+		}
+
+		complete(first, first)
+		others := make([]string, 2000)
+		for i := range others {
+			others[i] = fmt.Sprintf("%016x", i+2)
+		}
+		complete(others...)
+		if n := len(sub.Events()); n != 1 {
+			t.Fatal("the duplicate should be skipped, got events: ", n)
+		}
+
+		// forgotten, aria2 purged it too by default
+		complete(first)
+		if n := len(sub.Events()); n != 2 {
+			t.Fatal("expected a second event, got events: ", n)
+		}
+	})
+
+	t.Run("a ws client shares its connection with the listener", func(t *testing.T) {
+		srv := ariotest.NewServer()
+		defer srv.Close()
+
+		client, err := ario.NewClient(srv.WSURL, "", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		notify, err := client.NotifyListener(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer notify.Close()
+
+		if n := srv.Connections(); n != 1 {
+			t.Fatal("expected a single connection, got: ", n)
+		}
+
+		gid, err := client.AddURI([]string{"https://releases.ubuntu.com/22.04.2/ubuntu-22.04.2-live-server-amd64.iso"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case g := <-notify.Start():
+			if g != gid {
+				t.Fatal("unexpected gid: ", g)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no start event")
+		}
+	})
+
+	t.Run("polling emits the same events", func(t *testing.T) {
+		client, err := ario.NewClientWithOptions(srv.URL, ario.WithNotifyPolling(10*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		notify, err := client.NotifyListener(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer notify.Close()
+
+		gid, err := client.AddURI([]string{"https://releases.ubuntu.com/22.04.2/ubuntu-22.04.2-live-server-amd64.iso"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expect := func(ch <-chan string, event string) {
+			t.Helper()
+			for {
+				select {
+				case g := <-ch:
+					if g == gid {
+						return
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("no event: ", event)
+				}
+			}
+		}
+
+		expect(notify.Start(), "start")
+		if err := client.Pause(gid); err != nil {
+			t.Fatal(err)
+		}
+		expect(notify.Pause(), "pause")
+		if err := client.Unpause(gid); err != nil {
+			t.Fatal(err)
+		}
+		expect(notify.Start(), "start")
+		if err := srv.Complete(gid); err != nil {
+			t.Fatal(err)
+		}
+		expect(notify.Complete(), "complete")
+	})
+
+	t.Run("notify falls back to polling without websocket", func(t *testing.T) {
+		srv := ariotest.NewServer(ariotest.WithoutWebSocket())
+		defer srv.Close()
+
+		client, err := ario.NewClient(srv.URL, "", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		notify, err := client.NotifyListener(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer notify.Close()
+
+		gid, err := client.AddURI([]string{"https://releases.ubuntu.com/22.04.2/ubuntu-22.04.2-live-server-amd64.iso"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := client.Remove(gid); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case g := <-notify.Stop():
+			if g != gid {
+				t.Fatal("unexpected gid: ", g)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no stop event")
+		}
+	})
+
+	t.Run("failed polls are reported as a gap", func(t *testing.T) {
+		var (
+			mu    sync.Mutex
+			err   error
+			stats = []resp.Status{{Gid: "2089b05ecca3d829", Status: resp.StatusActive}}
+		)
+		snapshot := func(context.Context) ([]resp.Status, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return stats, err
+		}
+
+		notify, err := notifier.NewPollingNotifier(snapshot, 10*time.Millisecond).Listener(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer notify.Close()
+
+		mu.Lock()
+		err = errors.New("gateway timeout")
+		mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+
+		mu.Lock()
+		err, stats = nil, []resp.Status{{Gid: "2089b05ecca3d829", Status: resp.StatusComplete}}
+		mu.Unlock()
+
+		select {
+		case gap := <-notify.Gaps():
+			if !gap.Reconciled || gap.Err == nil || !gap.To.After(gap.From) {
+				t.Fatalf("unexpected gap %+v", gap)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no gap reported")
+		}
+
+		select {
+		case g := <-notify.Complete():
+			if g != "2089b05ecca3d829" {
+				t.Fatal("unexpected gid: ", g)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no complete event")
+		}
+	})
+
+	t.Run("events carry the method, the session and the status", func(t *testing.T) {
+		client, err := ario.NewClientWithOptions(srv.URL, ario.WithNotifyStatus("gid", "status", "totalLength"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		info, err := client.GetSessionInfo()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		notify, err := client.NotifyListener(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer notify.Close()
+
+		gid, err := client.AddURI([]string{"https://releases.ubuntu.com/22.04.2/ubuntu-22.04.2-live-server-amd64.iso"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for {
+			select {
+			case e := <-notify.Events():
+				if e.Gid != gid {
+					continue
+				}
+				if e.Kind != notifier.KindStart || e.Method != notifier.NotifyEvents.Start || e.Synthetic || e.Time.IsZero() {
+					t.Fatalf("unexpected event %+v", e)
+				}
+				if e.SessionID != info.Id {
+					t.Fatal("unexpected session: ", e.SessionID)
+				}
+				if e.StatusErr != nil {
+					t.Fatal(e.StatusErr)
+				}
+				if e.Status == nil || e.Status.Gid != gid || e.Status.TotalLength == 0 || e.Status.Dir != "" {
+					t.Fatalf("unexpected status %+v", e.Status)
+				}
+				return
+			case <-time.After(5 * time.Second):
+				t.Fatal("no start event")
+			}
+		}
+	})
+
+	t.Run("unknown methods are reported", func(t *testing.T) {
+		client, err := ario.NewClient(srv.WSURL, "", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		notify, err := client.NotifyListener(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer notify.Close()
+
+		custom := notify.Unknown()
+		srv.Notify("aria2.onDownloadRetry", "2089b05ecca3d829")
+
+		select {
+		case e := <-custom:
+			if e.Kind != notifier.KindUnknown || e.Method != "aria2.onDownloadRetry" || e.Gid != "2089b05ecca3d829" || len(e.Params) == 0 {
+				t.Fatalf("unexpected event %+v", e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no unknown event")
+		}
+
+		// listening to a method that is not in NotifyEvents does not panic
+		ch := make(chan string, 1)
+		go notify.ListenOnce("aria2.onDownloadRetry", func(gid string, stop func()) { ch <- gid })
+		time.Sleep(10 * time.Millisecond)
+		srv.Notify("aria2.onDownloadRetry", "2089b05ecca3d829")
+
+		select {
+		case g := <-ch:
+			if g != "2089b05ecca3d829" {
+				t.Fatal("unexpected gid: ", g)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+		}
+	})
+}
+
+func TestSubscribe(t *testing.T) {
+	srv := ariotest.NewServer()
+	defer srv.Close()
+
+	client, err := ario.NewClient(srv.WSURL, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	const gid = "2089b05ecca3d829"
+
+	receive := func(t *testing.T, sub *notifier.Subscription) (notifier.Event, bool) {
+		t.Helper()
+		select {
+		case e, ok := <-sub.Events():
+			return e, ok
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+		}
+		return notifier.Event{}, false
+	}
+
+	// notify sends the events, waits until they are dispatched, and returns
+	// their methods in the order they were dispatched, which may differ
+	notify := func(t *testing.T, n *notifier.Notify, methods ...string) []string {
+		t.Helper()
+		barrier := n.Subscribe()
+		defer barrier.Unsubscribe()
+
+		for _, m := range methods {
+			srv.Notify(m, gid)
+		}
+		var order []string
+		for range methods {
+			e, _ := receive(t, barrier)
+			order = append(order, e.Method)
+		}
+		return order
+	}
+
+	listen := func(t *testing.T) *notifier.Notify {
+		t.Helper()
+		n, err := client.NotifyListener(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(n.Close)
+		return n
+	}
+
+	events := []string{notifier.NotifyEvents.Start, notifier.NotifyEvents.Pause, notifier.NotifyEvents.Stop}
+
+	t.Run("every subscription receives every event", func(t *testing.T) {
+		n := listen(t)
+		a, b := n.Subscribe(), n.Subscribe()
+		order := notify(t, n, events...)
+
+		for _, sub := range []*notifier.Subscription{a, b} {
+			for _, m := range order {
+				if e, _ := receive(t, sub); e.Method != m || e.Gid != gid {
+					t.Fatalf("unexpected event %+v", e)
+				}
+			}
+		}
+	})
+
+	t.Run("drop newest", func(t *testing.T) {
+		n := listen(t)
+		sub := n.Subscribe(notifier.WithBuffer(1))
+		order := notify(t, n, events...)
+
+		if e, _ := receive(t, sub); e.Method != order[0] {
+			t.Fatalf("unexpected event %+v", e)
+		}
+		if sub.Dropped() != 2 {
+			t.Fatal("unexpected dropped events: ", sub.Dropped())
+		}
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		n := listen(t)
+		sub := n.Subscribe(notifier.WithBuffer(1), notifier.WithOverflow(notifier.OverflowDropOldest))
+		order := notify(t, n, events...)
+
+		if e, _ := receive(t, sub); e.Method != order[2] {
+			t.Fatalf("unexpected event %+v", e)
+		}
+		if sub.Dropped() != 2 {
+			t.Fatal("unexpected dropped events: ", sub.Dropped())
+		}
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		n := listen(t)
+		sub := n.Subscribe(notifier.WithBuffer(1), notifier.WithOverflow(notifier.OverflowDisconnect))
+		order := notify(t, n, events...)
+
+		if e, _ := receive(t, sub); e.Method != order[0] {
+			t.Fatalf("unexpected event %+v", e)
+		}
+		if _, ok := receive(t, sub); ok {
+			t.Fatal("the subscription should be closed")
+		}
+		if !errors.Is(sub.Err(), notifier.ErrOverflow) || sub.Dropped() != 1 {
+			t.Fatal("unexpected error: ", sub.Err(), sub.Dropped())
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		n := listen(t)
+		sub := n.Subscribe(notifier.WithBuffer(1), notifier.WithOverflow(notifier.OverflowBlock))
+		for _, m := range events {
+			srv.Notify(m, gid)
+		}
+
+		var got []string
+		for range events {
+			e, _ := receive(t, sub)
+			got = append(got, e.Method)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, slices.Sorted(slices.Values(events))) {
+			t.Fatal("unexpected events: ", got)
+		}
+		if sub.Dropped() != 0 {
+			t.Fatal("unexpected dropped events: ", sub.Dropped())
+		}
+
+		// a blocked subscription does not prevent closing
+		srv.Notify(notifier.NotifyEvents.Start, gid)
+		srv.Notify(notifier.NotifyEvents.Start, gid)
+		time.Sleep(10 * time.Millisecond)
+
+		errc := make(chan error, 1)
+		go func() { errc <- sub.Err() }()
+		select {
+		case err := <-errc:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Err blocked by a blocked send")
+		}
+
+		n.Close()
+		for range sub.Events() {
+		}
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		n := listen(t)
+		sub := n.Subscribe(notifier.WithKinds(notifier.KindComplete), notifier.WithGIDs(gid))
+
+		srv.Notify(notifier.NotifyEvents.Complete, "d2703803b52216d1")
+		notify(t, n, notifier.NotifyEvents.Start, notifier.NotifyEvents.Complete)
+
+		if e, _ := receive(t, sub); e.Kind != notifier.KindComplete || e.Gid != gid {
+			t.Fatalf("unexpected event %+v", e)
+		}
+		select {
+		case e := <-sub.Events():
+			t.Fatalf("unexpected event %+v", e)
+		default:
+		}
+	})
+
+	t.Run("unsubscribe", func(t *testing.T) {
+		n := listen(t)
+		sub := n.Subscribe()
+		sub.Unsubscribe()
+		sub.Unsubscribe()
+		notify(t, n, events...)
+
+		if _, ok := receive(t, sub); ok {
+			t.Fatal("the subscription should be closed")
+		}
+	})
+}
+
+func TestHandle(t *testing.T) {
+	srv := ariotest.NewServer()
+	defer srv.Close()
+
+	client, err := ario.NewClient(srv.WSURL, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	notify, err := client.NotifyListener(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer notify.Close()
+
+	const gid = "2089b05ecca3d829"
+
+	wait := func(t *testing.T, ch <-chan struct{}) {
+		t.Helper()
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out")
+		}
+	}
+
+	t.Run("unsubscribe", func(t *testing.T) {
+		called := make(chan struct{}, 10)
+		sub := notify.Handle(context.Background(), func(e notifier.Event) { called <- struct{}{} }, notifier.WithGIDs(gid))
+
+		srv.Notify(notifier.NotifyEvents.Start, gid)
+		wait(t, called)
+
+		sub.Unsubscribe()
+		wait(t, sub.Done())
+		if sub.Err() != nil {
+			t.Fatal(sub.Err())
+		}
+
+		srv.Notify(notifier.NotifyEvents.Pause, gid)
+		time.Sleep(10 * time.Millisecond)
+		if len(called) != 0 {
+			t.Fatal("the handler should not be called after unsubscribing")
+		}
+	})
+
+	t.Run("a panic ends the subscription", func(t *testing.T) {
+		sub := notify.Handle(context.Background(), func(e notifier.Event) { panic("boom") }, notifier.WithGIDs(gid))
+
+		srv.Notify(notifier.NotifyEvents.Start, gid)
+		wait(t, sub.Done())
+
+		var perr *notifier.PanicError
+		if !errors.As(sub.Err(), &perr) || perr.Value != "boom" || perr.Event.Gid != gid || len(perr.Stack) == 0 {
+			t.Fatal("unexpected error: ", sub.Err())
+		}
+	})
+
+	t.Run("a panic is reported to the panic handler", func(t *testing.T) {
+		panics := make(chan *notifier.PanicError, 10)
+		called := make(chan string, 10)
+		sub := notify.Handle(context.Background(), func(e notifier.Event) {
+			called <- e.Method
+			if e.Kind == notifier.KindStart {
+				panic("boom")
+			}
+		}, notifier.WithGIDs(gid), notifier.WithPanicHandler(func(err *notifier.PanicError) { panics <- err }))
+		defer sub.Unsubscribe()
+
+		srv.Notify(notifier.NotifyEvents.Start, gid)
+		srv.Notify(notifier.NotifyEvents.Pause, gid)
+		for range 2 {
+			select {
+			case <-called:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the handler should be called after a panic")
+			}
+		}
+		if len(panics) != 1 {
+			t.Fatal("unexpected panics: ", len(panics))
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		sub := notify.Handle(ctx, func(e notifier.Event) {})
+
+		cancel()
+		wait(t, sub.Done())
+		if !errors.Is(sub.Err(), context.Canceled) {
+			t.Fatal("unexpected error: ", sub.Err())
+		}
+	})
+
+	t.Run("once", func(t *testing.T) {
+		var (
+			mu    sync.Mutex
+			calls int
+		)
+		sub := notify.HandleOnce(context.Background(), func(e notifier.Event) {
+			mu.Lock()
+			calls++
+			mu.Unlock()
+		}, notifier.WithGIDs(gid))
+
+		for range 3 {
+			srv.Notify(notifier.NotifyEvents.Start, gid)
+		}
+		wait(t, sub.Done())
+
+		mu.Lock()
+		defer mu.Unlock()
+		if calls != 1 {
+			t.Fatal("unexpected calls: ", calls)
+		}
+	})
+
+	t.Run("listen once stops right away", func(t *testing.T) {
+		returned := make(chan struct{})
+		go func() {
+			defer close(returned)
+			notify.ListenOnce(notifier.NotifyEvents.Complete, func(g string, stop func()) { stop() })
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		srv.Notify(notifier.NotifyEvents.Complete, gid)
+		wait(t, returned)
+	})
+
+	t.Run("listen once reports a panic", func(t *testing.T) {
+		errc := make(chan error, 1)
+		go func() {
+			errc <- notify.ListenOnce(notifier.NotifyEvents.Complete, func(g string, stop func()) { panic("boom") })
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		srv.Notify(notifier.NotifyEvents.Complete, "d2703803b52216d1")
+
+		var perr *notifier.PanicError
+		select {
+		case err := <-errc:
+			if !errors.As(err, &perr) || perr.Value != "boom" {
+				t.Fatal("expected a panic error, got", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("ListenOnce did not return")
+		}
+	})
+
+	t.Run("closing the notify ends the handlers", func(t *testing.T) {
+		notify, err := client.NotifyListener(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		sub := notify.Handle(context.Background(), func(e notifier.Event) {})
+
+		notify.Close()
+		wait(t, sub.Done())
+	})
 }
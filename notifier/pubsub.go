@@ -0,0 +1,300 @@
+package notifier
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrOverflow is the error of a subscription with OverflowDisconnect that was
+// closed because its buffer was full.
+var ErrOverflow = errors.New("notifier: subscription buffer overflow")
+
+// DefaultBuffer is the default buffer size of a subscription.
+const DefaultBuffer = 64
+
+// Overflow is what a subscription does with an event when its buffer is full.
+type Overflow int
+
+const (
+	// OverflowDropNewest drops the event, it is the default.
+	OverflowDropNewest Overflow = iota
+	// OverflowDropOldest drops the oldest buffered event to make room.
+	OverflowDropOldest
+	// OverflowBlock waits until the subscriber receives the event. The events
+	// of every subscriber are delayed meanwhile, they are queued without
+	// limit.
+	OverflowBlock
+	// OverflowDisconnect closes the subscription, Err then returns
+	// ErrOverflow.
+	OverflowDisconnect
+)
+
+// SubscribeOption configures a Subscription created by Notify.Subscribe.
+type SubscribeOption func(*subscribeConfig)
+
+type subscribeConfig struct {
+	buffer   int
+	overflow Overflow
+	kinds    []EventKind
+	gids     []string
+	methods  []string
+	onPanic  func(*PanicError)
+}
+
+// WithBuffer sets the buffer size of the subscription, DefaultBuffer by
+// default.
+func WithBuffer(n int) SubscribeOption {
+	return func(c *subscribeConfig) { c.buffer = n }
+}
+
+// WithOverflow sets what happens when the buffer of the subscription is full.
+func WithOverflow(o Overflow) SubscribeOption {
+	return func(c *subscribeConfig) { c.overflow = o }
+}
+
+// WithKinds only delivers the events of the given kinds.
+func WithKinds(kinds ...EventKind) SubscribeOption {
+	return func(c *subscribeConfig) { c.kinds = append(c.kinds, kinds...) }
+}
+
+// WithGIDs only delivers the events of the given downloads.
+func WithGIDs(gids ...string) SubscribeOption {
+	return func(c *subscribeConfig) { c.gids = append(c.gids, gids...) }
+}
+
+// WithMethods only delivers the events of the given methods, e.g. the ones of
+// KindUnknown.
+func WithMethods(methods ...string) SubscribeOption {
+	return func(c *subscribeConfig) { c.methods = append(c.methods, methods...) }
+}
+
+// WithPanicHandler sets the function called when the handler of the
+// subscription panics, the handler is then called with the next events. By
+// default, a panic ends the subscription and is returned by Err.
+func WithPanicHandler(fn func(*PanicError)) SubscribeOption {
+	return func(c *subscribeConfig) { c.onPanic = fn }
+}
+
+// Subscription receives the events of a Notify on its own buffered channel.
+type Subscription struct {
+	cfg     subscribeConfig
+	ch      chan Event
+	dropped atomic.Uint64
+	b       *broker
+
+	once     sync.Once
+	done     chan struct{} // closed by stop, before ch
+	handled  bool          // whether a handler receives the events
+	finished chan struct{} // see Done
+
+	sendMu sync.Mutex // held while sending to ch, and to close it
+
+	mu     sync.Mutex
+	closed bool
+	err    error
+}
+
+// Events returns the channel of the subscription, it is closed by
+// Unsubscribe, on overflow with OverflowDisconnect, or when the Notify is
+// closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Dropped returns the number of events dropped because the buffer was full.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Done returns a channel that is closed once the subscription ended, and its
+// handler returned if any.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.finished
+}
+
+// Err returns why the subscription ended: ErrOverflow on overflow, a
+// *PanicError if its handler panicked, the error of the context of its
+// handler, or nil.
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Unsubscribe stops the delivery of the events and closes the channel. It can
+// be called more than once.
+func (s *Subscription) Unsubscribe() {
+	s.stop(nil)
+	s.b.remove(s)
+}
+
+func (s *Subscription) stop(err error) {
+	// a blocked send holds sendMu until done is closed
+	s.once.Do(func() { close(s.done) })
+
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	s.closeLocked(err)
+}
+
+// closeLocked closes ch, sendMu must be held.
+func (s *Subscription) closeLocked(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed, s.err = true, err
+	close(s.ch)
+	if !s.handled {
+		close(s.finished)
+	}
+}
+
+func (s *Subscription) matches(e Event) bool {
+	if len(s.cfg.kinds) > 0 && !slices.Contains(s.cfg.kinds, e.Kind) {
+		return false
+	}
+	if len(s.cfg.methods) > 0 && !slices.Contains(s.cfg.methods, e.Method) {
+		return false
+	}
+	return len(s.cfg.gids) == 0 || slices.Contains(s.cfg.gids, e.Gid)
+}
+
+// send delivers e according to the overflow policy. It reports whether the
+// subscription is still open.
+func (s *Subscription) send(e Event, closing <-chan struct{}) bool {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+
+	select {
+	case s.ch <- e:
+		return true
+	default:
+	}
+
+	switch s.cfg.overflow {
+	case OverflowDropOldest:
+		if cap(s.ch) == 0 {
+			break
+		}
+		for {
+			select {
+			case <-s.ch:
+				s.dropped.Add(1)
+			default:
+			}
+			select {
+			case s.ch <- e:
+				return true
+			default:
+			}
+		}
+	case OverflowBlock:
+		select {
+		case s.ch <- e:
+		case <-s.done:
+			s.dropped.Add(1)
+		case <-closing:
+			s.dropped.Add(1)
+		}
+		return true
+	case OverflowDisconnect:
+		s.dropped.Add(1)
+		s.once.Do(func() { close(s.done) })
+		s.closeLocked(ErrOverflow)
+		return false
+	}
+
+	s.dropped.Add(1)
+	return true
+}
+
+// broker fans the events out to the subscriptions.
+type broker struct {
+	closing chan struct{} // closed when the listener is closed, to stop blocking
+
+	mu     sync.Mutex
+	subs   []*Subscription
+	closed bool
+}
+
+func newBroker() *broker {
+	return &broker{closing: make(chan struct{})}
+}
+
+func (b *broker) subscribe(opts []SubscribeOption, handled bool) *Subscription {
+	cfg := subscribeConfig{buffer: DefaultBuffer}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	s := &Subscription{
+		cfg:      cfg,
+		ch:       make(chan Event, max(cfg.buffer, 0)),
+		b:        b,
+		done:     make(chan struct{}),
+		handled:  handled,
+		finished: make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		s.stop(nil)
+		return s
+	}
+	b.subs = append(b.subs, s)
+	return s
+}
+
+func (b *broker) remove(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs = slices.DeleteFunc(b.subs, func(x *Subscription) bool { return x == s })
+}
+
+// publish sends e to the matching subscriptions, it is only called by the
+// dispatching goroutine.
+func (b *broker) publish(e Event) {
+	b.mu.Lock()
+	subs := slices.Clone(b.subs)
+	b.mu.Unlock()
+
+	for _, s := range subs {
+		if !s.matches(e) {
+			continue
+		}
+		if !s.send(e, b.closing) {
+			b.remove(s)
+		}
+	}
+}
+
+// interrupt stops the blocked sends, before the remaining events are
+// dispatched.
+func (b *broker) interrupt() {
+	close(b.closing)
+}
+
+// close closes every subscription.
+func (b *broker) close() {
+	b.mu.Lock()
+	subs := b.subs
+	b.subs, b.closed = nil, true
+	b.mu.Unlock()
+
+	for _, s := range subs {
+		s.stop(nil)
+	}
+}
@@ -0,0 +1,479 @@
+package ario
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// OptionType is the type of the value of an aria2 option.
+type OptionType int
+
+const (
+	OptionString OptionType = iota // free-form text
+	OptionBool                     // true or false
+	OptionInt                      // integer, within Min and Max
+	OptionFloat                    // decimal number, within Min and Max
+	OptionSize                     // size in bytes with an optional K or M suffix, e.g. 20M, within Min and Max
+	OptionEnum                     // one of Values
+	OptionList                     // may be given several times, e.g. header
+)
+
+func (t OptionType) String() string {
+	switch t {
+	case OptionString:
+		return "string"
+	case OptionBool:
+		return "bool"
+	case OptionInt:
+		return "int"
+	case OptionFloat:
+		return "float"
+	case OptionSize:
+		return "size"
+	case OptionEnum:
+		return "enum"
+	case OptionList:
+		return "list"
+	}
+	return fmt.Sprintf("OptionType(%d)", int(t))
+}
+
+// OptionScope tells where an aria2 option can be used.
+type OptionScope int
+
+const (
+	ScopeDownload   OptionScope = iota // per download, the global value is the default of new downloads
+	ScopeBitTorrent                    // per download, only for BitTorrent downloads
+	ScopeGlobal                        // only for aria2 itself
+)
+
+func (s OptionScope) String() string {
+	switch s {
+	case ScopeDownload:
+		return "download"
+	case ScopeBitTorrent:
+		return "bittorrent"
+	case ScopeGlobal:
+		return "global"
+	}
+	return fmt.Sprintf("OptionScope(%d)", int(s))
+}
+
+// unbounded is the Max of the options without an upper bound.
+const unbounded = math.MaxFloat64
+
+// OptionInfo describes an aria2 option.
+//
+// see: https://aria2.github.io/manual/en/html/aria2c.html#options
+type OptionInfo struct {
+	Name    string
+	Type    OptionType
+	Min     float64  // lower bound of OptionInt, OptionFloat and OptionSize values
+	Max     float64  // upper bound, math.MaxFloat64 if there is none
+	Values  []string // allowed values of OptionEnum
+	Default string   // default value, empty if there is none
+	Scope   OptionScope
+
+	Changeable       bool // can be changed by aria2.changeOption on a waiting or paused download
+	ActiveChangeable bool // can be changed by aria2.changeOption on an active download
+	GlobalChangeable bool // can be changed by aria2.changeGlobalOption
+}
+
+var optionInfos = map[string]OptionInfo{
+	"all-proxy":                        {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"all-proxy-passwd":                 {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"all-proxy-user":                   {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"allow-overwrite":                  {Type: OptionBool, Default: "false", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"allow-piece-length-change":        {Type: OptionBool, Default: "false", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"always-resume":                    {Type: OptionBool, Default: "true", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"async-dns":                        {Type: OptionBool, Default: "true", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"auto-file-renaming":               {Type: OptionBool, Default: "true", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"bt-enable-hook-after-hash-check":  {Type: OptionBool, Default: "true", Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"bt-enable-lpd":                    {Type: OptionBool, Default: "false", Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"bt-exclude-tracker":               {Type: OptionString, Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"bt-external-ip":                   {Type: OptionString, Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"bt-force-encryption":              {Type: OptionBool, Default: "false", Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"bt-hash-check-seed":               {Type: OptionBool, Default: "true", Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"bt-load-saved-metadata":           {Type: OptionBool, Default: "false", Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"bt-max-peers":                     {Type: OptionInt, Min: 0, Max: unbounded, Default: "55", Scope: ScopeBitTorrent, Changeable: true, ActiveChangeable: true, GlobalChangeable: true},
+	"bt-metadata-only":                 {Type: OptionBool, Default: "false", Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"bt-min-crypto-level":              {Type: OptionEnum, Values: []string{"plain", "arc4"}, Default: "plain", Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"bt-prioritize-piece":              {Type: OptionString, Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"bt-remove-unselected-file":        {Type: OptionBool, Default: "false", Scope: ScopeBitTorrent, Changeable: true, ActiveChangeable: true, GlobalChangeable: true},
+	"bt-request-peer-speed-limit":      {Type: OptionSize, Min: 0, Max: unbounded, Default: "50K", Scope: ScopeBitTorrent, Changeable: true, ActiveChangeable: true, GlobalChangeable: true},
+	"bt-require-crypto":                {Type: OptionBool, Default: "false", Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"bt-save-metadata":                 {Type: OptionBool, Default: "false", Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"bt-seed-unverified":               {Type: OptionBool, Default: "false", Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"bt-stop-timeout":                  {Type: OptionInt, Min: 0, Max: unbounded, Default: "0", Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"bt-tracker":                       {Type: OptionString, Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"bt-tracker-connect-timeout":       {Type: OptionInt, Min: 1, Max: 600, Default: "60", Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"bt-tracker-interval":              {Type: OptionInt, Min: 0, Max: unbounded, Default: "0", Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"bt-tracker-timeout":               {Type: OptionInt, Min: 1, Max: 600, Default: "60", Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"check-integrity":                  {Type: OptionBool, Default: "false", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"checksum":                         {Type: OptionString, Scope: ScopeDownload, Changeable: true},
+	"conditional-get":                  {Type: OptionBool, Default: "false", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"connect-timeout":                  {Type: OptionInt, Min: 1, Max: 600, Default: "60", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"content-disposition-default-utf8": {Type: OptionBool, Default: "false", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"continue":                         {Type: OptionBool, Default: "false", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"dir":                              {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"dry-run":                          {Type: OptionBool, Default: "false", Scope: ScopeDownload, GlobalChangeable: true},
+	"enable-http-keep-alive":           {Type: OptionBool, Default: "true", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"enable-http-pipelining":           {Type: OptionBool, Default: "false", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"enable-mmap":                      {Type: OptionBool, Default: "false", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"enable-peer-exchange":             {Type: OptionBool, Default: "true", Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"file-allocation":                  {Type: OptionEnum, Values: []string{"none", "prealloc", "trunc", "falloc"}, Default: "prealloc", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"follow-metalink":                  {Type: OptionEnum, Values: []string{"true", "false", "mem"}, Default: "true", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"follow-torrent":                   {Type: OptionEnum, Values: []string{"true", "false", "mem"}, Default: "true", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"force-save":                       {Type: OptionBool, Default: "false", Scope: ScopeDownload, Changeable: true, ActiveChangeable: true, GlobalChangeable: true},
+	"ftp-passwd":                       {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"ftp-pasv":                         {Type: OptionBool, Default: "true", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"ftp-proxy":                        {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"ftp-proxy-passwd":                 {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"ftp-proxy-user":                   {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"ftp-reuse-connection":             {Type: OptionBool, Default: "true", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"ftp-type":                         {Type: OptionEnum, Values: []string{"binary", "ascii"}, Default: "binary", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"ftp-user":                         {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"gid":                              {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"hash-check-only":                  {Type: OptionBool, Default: "false", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"header":                           {Type: OptionList, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"http-accept-gzip":                 {Type: OptionBool, Default: "false", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"http-auth-challenge":              {Type: OptionBool, Default: "false", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"http-no-cache":                    {Type: OptionBool, Default: "false", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"http-passwd":                      {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"http-proxy":                       {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"http-proxy-passwd":                {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"http-proxy-user":                  {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"http-user":                        {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"https-proxy":                      {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"https-proxy-passwd":               {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"https-proxy-user":                 {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"index-out":                        {Type: OptionList, Scope: ScopeBitTorrent, Changeable: true},
+	"lowest-speed-limit":               {Type: OptionSize, Min: 0, Max: unbounded, Default: "0", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"max-connection-per-server":        {Type: OptionInt, Min: 1, Max: 16, Default: "1", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"max-download-limit":               {Type: OptionSize, Min: 0, Max: unbounded, Default: "0", Scope: ScopeDownload, Changeable: true, ActiveChangeable: true, GlobalChangeable: true},
+	"max-file-not-found":               {Type: OptionInt, Min: 0, Max: unbounded, Default: "0", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"max-mmap-limit":                   {Type: OptionSize, Min: 0, Max: unbounded, Default: "9223372036854775807", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"max-resume-failure-tries":         {Type: OptionInt, Min: 0, Max: unbounded, Default: "0", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"max-tries":                        {Type: OptionInt, Min: 0, Max: unbounded, Default: "5", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"max-upload-limit":                 {Type: OptionSize, Min: 0, Max: unbounded, Default: "0", Scope: ScopeDownload, Changeable: true, ActiveChangeable: true, GlobalChangeable: true},
+	"metalink-base-uri":                {Type: OptionString, Scope: ScopeDownload, GlobalChangeable: true},
+	"metalink-enable-unique-protocol":  {Type: OptionBool, Default: "true", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"metalink-language":                {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"metalink-location":                {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"metalink-os":                      {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"metalink-preferred-protocol":      {Type: OptionEnum, Values: []string{"http", "https", "ftp", "none"}, Default: "none", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"metalink-version":                 {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"min-split-size":                   {Type: OptionSize, Min: 1048576, Max: 1073741824, Default: "20M", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"no-file-allocation-limit":         {Type: OptionSize, Min: 0, Max: unbounded, Default: "5M", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"no-netrc":                         {Type: OptionBool, Default: "false", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"no-proxy":                         {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"out":                              {Type: OptionString, Scope: ScopeDownload, Changeable: true},
+	"parameterized-uri":                {Type: OptionBool, Default: "false", Scope: ScopeDownload, GlobalChangeable: true},
+	"pause":                            {Type: OptionBool, Default: "false", Scope: ScopeDownload},
+	"pause-metadata":                   {Type: OptionBool, Default: "false", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"piece-length":                     {Type: OptionSize, Min: 1048576, Max: 1073741824, Default: "1M", Scope: ScopeDownload, GlobalChangeable: true},
+	"proxy-method":                     {Type: OptionEnum, Values: []string{"get", "tunnel"}, Default: "get", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"realtime-chunk-checksum":          {Type: OptionBool, Default: "true", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"referer":                          {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"remote-time":                      {Type: OptionBool, Default: "false", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"remove-control-file":              {Type: OptionBool, Default: "false", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"retry-wait":                       {Type: OptionInt, Min: 0, Max: 600, Default: "0", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"reuse-uri":                        {Type: OptionBool, Default: "true", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"rpc-save-upload-metadata":         {Type: OptionBool, Default: "true", Scope: ScopeDownload, GlobalChangeable: true},
+	"seed-ratio":                       {Type: OptionFloat, Min: 0, Max: unbounded, Default: "1.0", Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"seed-time":                        {Type: OptionFloat, Min: 0, Max: unbounded, Scope: ScopeBitTorrent, Changeable: true, GlobalChangeable: true},
+	"select-file":                      {Type: OptionString, Scope: ScopeDownload, Changeable: true},
+	"split":                            {Type: OptionInt, Min: 1, Max: unbounded, Default: "5", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"ssh-host-key-md":                  {Type: OptionString, Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"stream-piece-selector":            {Type: OptionEnum, Values: []string{"default", "inorder", "random", "geom"}, Default: "default", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"timeout":                          {Type: OptionInt, Min: 1, Max: 600, Default: "60", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"uri-selector":                     {Type: OptionEnum, Values: []string{"inorder", "feedback", "adaptive"}, Default: "feedback", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"use-head":                         {Type: OptionBool, Default: "false", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"user-agent":                       {Type: OptionString, Default: "aria2/$VERSION", Scope: ScopeDownload, Changeable: true, GlobalChangeable: true},
+	"async-dns-server":                 {Type: OptionString, Scope: ScopeGlobal},
+	"auto-save-interval":               {Type: OptionInt, Min: 0, Max: 600, Default: "60", Scope: ScopeGlobal},
+	"bt-detach-seed-only":              {Type: OptionBool, Default: "false", Scope: ScopeGlobal},
+	"bt-lpd-interface":                 {Type: OptionString, Scope: ScopeGlobal},
+	"bt-max-open-files":                {Type: OptionInt, Min: 1, Max: unbounded, Default: "100", Scope: ScopeGlobal, GlobalChangeable: true},
+	"ca-certificate":                   {Type: OptionString, Scope: ScopeGlobal},
+	"certificate":                      {Type: OptionString, Scope: ScopeGlobal},
+	"check-certificate":                {Type: OptionBool, Default: "true", Scope: ScopeGlobal},
+	"conf-path":                        {Type: OptionString, Default: "$HOME/.aria2/aria2.conf", Scope: ScopeGlobal},
+	"console-log-level":                {Type: OptionEnum, Values: []string{"debug", "info", "notice", "warn", "error"}, Default: "notice", Scope: ScopeGlobal},
+	"daemon":                           {Type: OptionBool, Default: "false", Scope: ScopeGlobal},
+	"deferred-input":                   {Type: OptionBool, Default: "false", Scope: ScopeGlobal},
+	"dht-entry-point":                  {Type: OptionString, Scope: ScopeGlobal},
+	"dht-entry-point6":                 {Type: OptionString, Scope: ScopeGlobal},
+	"dht-file-path":                    {Type: OptionString, Default: "$HOME/.aria2/dht.dat", Scope: ScopeGlobal},
+	"dht-file-path6":                   {Type: OptionString, Default: "$HOME/.aria2/dht6.dat", Scope: ScopeGlobal},
+	"dht-listen-addr6":                 {Type: OptionString, Scope: ScopeGlobal},
+	"dht-listen-port":                  {Type: OptionString, Default: "6881-6999", Scope: ScopeGlobal},
+	"dht-message-timeout":              {Type: OptionInt, Min: 1, Max: 60, Default: "10", Scope: ScopeGlobal},
+	"disable-ipv6":                     {Type: OptionBool, Default: "false", Scope: ScopeGlobal},
+	"disk-cache":                       {Type: OptionSize, Min: 0, Max: unbounded, Default: "16M", Scope: ScopeGlobal},
+	"download-result":                  {Type: OptionEnum, Values: []string{"default", "full", "hide"}, Default: "default", Scope: ScopeGlobal, GlobalChangeable: true},
+	"dscp":                             {Type: OptionInt, Min: 0, Max: 63, Default: "0", Scope: ScopeGlobal},
+	"enable-color":                     {Type: OptionBool, Default: "true", Scope: ScopeGlobal},
+	"enable-dht":                       {Type: OptionBool, Default: "true", Scope: ScopeGlobal},
+	"enable-dht6":                      {Type: OptionBool, Default: "false", Scope: ScopeGlobal},
+	"enable-rpc":                       {Type: OptionBool, Default: "false", Scope: ScopeGlobal},
+	"event-poll":                       {Type: OptionEnum, Values: []string{"epoll", "kqueue", "port", "poll", "select"}, Default: "epoll", Scope: ScopeGlobal},
+	"force-sequential":                 {Type: OptionBool, Default: "false", Scope: ScopeGlobal},
+	"human-readable":                   {Type: OptionBool, Default: "true", Scope: ScopeGlobal},
+	"input-file":                       {Type: OptionString, Scope: ScopeGlobal},
+	"interface":                        {Type: OptionString, Scope: ScopeGlobal},
+	"keep-unfinished-download-result":  {Type: OptionBool, Default: "true", Scope: ScopeGlobal, GlobalChangeable: true},
+	"listen-port":                      {Type: OptionString, Default: "6881-6999", Scope: ScopeGlobal},
+	"load-cookies":                     {Type: OptionString, Scope: ScopeGlobal},
+	"log":                              {Type: OptionString, Scope: ScopeGlobal, GlobalChangeable: true},
+	"log-level":                        {Type: OptionEnum, Values: []string{"debug", "info", "notice", "warn", "error"}, Default: "debug", Scope: ScopeGlobal, GlobalChangeable: true},
+	"max-concurrent-downloads":         {Type: OptionInt, Min: 1, Max: unbounded, Default: "5", Scope: ScopeGlobal, GlobalChangeable: true},
+	"max-download-result":              {Type: OptionInt, Min: 0, Max: unbounded, Default: "1000", Scope: ScopeGlobal, GlobalChangeable: true},
+	"max-overall-download-limit":       {Type: OptionSize, Min: 0, Max: unbounded, Default: "0", Scope: ScopeGlobal, GlobalChangeable: true},
+	"max-overall-upload-limit":         {Type: OptionSize, Min: 0, Max: unbounded, Default: "0", Scope: ScopeGlobal, GlobalChangeable: true},
+	"min-tls-version":                  {Type: OptionEnum, Values: []string{"TLSv1.1", "TLSv1.2", "TLSv1.3"}, Default: "TLSv1.2", Scope: ScopeGlobal},
+	"multiple-interface":               {Type: OptionString, Scope: ScopeGlobal},
+	"netrc-path":                       {Type: OptionString, Default: "$HOME/.netrc", Scope: ScopeGlobal},
+	"on-bt-download-complete":          {Type: OptionString, Scope: ScopeGlobal},
+	"on-download-complete":             {Type: OptionString, Scope: ScopeGlobal},
+	"on-download-error":                {Type: OptionString, Scope: ScopeGlobal},
+	"on-download-pause":                {Type: OptionString, Scope: ScopeGlobal},
+	"on-download-start":                {Type: OptionString, Scope: ScopeGlobal},
+	"on-download-stop":                 {Type: OptionString, Scope: ScopeGlobal},
+	"optimize-concurrent-downloads":    {Type: OptionString, Default: "false", Scope: ScopeGlobal, GlobalChangeable: true},
+	"peer-agent":                       {Type: OptionString, Default: "aria2/$VERSION", Scope: ScopeGlobal},
+	"peer-id-prefix":                   {Type: OptionString, Default: "A2-$MAJOR-$MINOR-$PATCH-", Scope: ScopeGlobal},
+	"private-key":                      {Type: OptionString, Scope: ScopeGlobal},
+	"quiet":                            {Type: OptionBool, Default: "false", Scope: ScopeGlobal},
+	"rlimit-nofile":                    {Type: OptionInt, Min: 1, Max: unbounded, Scope: ScopeGlobal},
+	"rpc-allow-origin-all":             {Type: OptionBool, Default: "false", Scope: ScopeGlobal},
+	"rpc-certificate":                  {Type: OptionString, Scope: ScopeGlobal},
+	"rpc-listen-all":                   {Type: OptionBool, Default: "false", Scope: ScopeGlobal},
+	"rpc-listen-port":                  {Type: OptionInt, Min: 1024, Max: 65535, Default: "6800", Scope: ScopeGlobal},
+	"rpc-max-request-size":             {Type: OptionSize, Min: 0, Max: unbounded, Default: "2M", Scope: ScopeGlobal},
+	"rpc-passwd":                       {Type: OptionString, Scope: ScopeGlobal},
+	"rpc-private-key":                  {Type: OptionString, Scope: ScopeGlobal},
+	"rpc-secret":                       {Type: OptionString, Scope: ScopeGlobal},
+	"rpc-secure":                       {Type: OptionBool, Default: "false", Scope: ScopeGlobal},
+	"rpc-user":                         {Type: OptionString, Scope: ScopeGlobal},
+	"save-cookies":                     {Type: OptionString, Scope: ScopeGlobal, GlobalChangeable: true},
+	"save-not-found":                   {Type: OptionBool, Default: "true", Scope: ScopeGlobal},
+	"save-session":                     {Type: OptionString, Scope: ScopeGlobal, GlobalChangeable: true},
+	"save-session-interval":            {Type: OptionInt, Min: 0, Max: unbounded, Default: "0", Scope: ScopeGlobal},
+	"server-stat-if":                   {Type: OptionString, Scope: ScopeGlobal},
+	"server-stat-of":                   {Type: OptionString, Scope: ScopeGlobal, GlobalChangeable: true},
+	"server-stat-timeout":              {Type: OptionInt, Min: 0, Max: unbounded, Default: "86400", Scope: ScopeGlobal},
+	"socket-recv-buffer-size":          {Type: OptionSize, Min: 0, Max: 16777216, Default: "0", Scope: ScopeGlobal},
+	"stderr":                           {Type: OptionBool, Default: "false", Scope: ScopeGlobal},
+	"stop":                             {Type: OptionInt, Min: 0, Max: unbounded, Default: "0", Scope: ScopeGlobal},
+	"stop-with-process":                {Type: OptionInt, Min: 0, Max: unbounded, Scope: ScopeGlobal},
+	"summary-interval":                 {Type: OptionInt, Min: 0, Max: unbounded, Default: "60", Scope: ScopeGlobal},
+	"truncate-console-readout":         {Type: OptionBool, Default: "true", Scope: ScopeGlobal},
+}
+
+func init() {
+	for name, info := range optionInfos {
+		info.Name = name
+		optionInfos[name] = info
+	}
+}
+
+// LookupOption returns the description of the aria2 option name, e.g.
+// "max-download-limit".
+func LookupOption(name string) (OptionInfo, bool) {
+	info, ok := optionInfos[name]
+	return info, ok
+}
+
+// OptionInfos returns the description of every aria2 option, sorted by name.
+func OptionInfos() []OptionInfo {
+	infos := make([]OptionInfo, 0, len(optionInfos))
+	for _, info := range optionInfos {
+		infos = append(infos, info)
+	}
+	slices.SortFunc(infos, func(a, b OptionInfo) int { return strings.Compare(a.Name, b.Name) })
+	return infos
+}
+
+// OptionError reports an option rejected before it was sent to aria2. It
+// wraps ErrInvalidOption.
+type OptionError struct {
+	Field  string // field of Options, or Extra["name"]
+	Option string // name of the aria2 option
+	Value  string
+	Reason string
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("invalid option %s (%s=%q): %s", e.Field, e.Option, e.Value, e.Reason)
+}
+
+func (e *OptionError) Unwrap() error {
+	return ErrInvalidOption
+}
+
+// Validate checks the values of the options against their description, and
+// rejects the global only ones, as the methods that send them do. It returns
+// an *OptionError for the first invalid one.
+func (o *Options) Validate() error {
+	return validateOptions(reflect.ValueOf(o).Elem(), o.Extra, true)
+}
+
+// Validate checks the values of the options against their description. It
+// returns an *OptionError for the first invalid one.
+func (o *GlobalOptions) Validate() error {
+	return validateOptions(reflect.ValueOf(o).Elem(), o.Extra, false)
+}
+
+// validate checks the options of a download before they are sent. Options
+// that cannot be changed are not rejected, aria2 ignores them, so that the
+// result of aria2.getOption can be given back to aria2.changeOption.
+func (o *Options) validate() error {
+	if o == nil {
+		return nil
+	}
+	return o.Validate()
+}
+
+func (o *GlobalOptions) validate() error {
+	if o == nil {
+		return nil
+	}
+	return o.Validate()
+}
+
+// validateOptions checks the options set in v and extra. If download is true,
+// the global only options are rejected.
+func validateOptions(v reflect.Value, extra map[string]string, download bool) error {
+	check := func(field, name string, values []string) error {
+		info, ok := optionInfos[name]
+		if !ok {
+			// unknown to this version, leave it to aria2
+			return nil
+		}
+
+		for _, value := range values {
+			reason := info.check(value)
+			if download && info.Scope == ScopeGlobal {
+				reason = "only a global option"
+			}
+			if reason != "" {
+				return &OptionError{Field: field, Option: name, Value: value, Reason: reason}
+			}
+		}
+		return nil
+	}
+
+	err := optionFields(v, func(sf reflect.StructField, name string, f reflect.Value) error {
+		if f.IsNil() {
+			return nil
+		}
+		if f.Kind() == reflect.Slice {
+			return check(sf.Name, name, f.Interface().([]string))
+		}
+
+		s, err := formatOption(sf, f)
+		if err != nil {
+			return &OptionError{Field: sf.Name, Option: name, Reason: err.Error()}
+		}
+		return check(sf.Name, name, []string{s})
+	})
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(extra))
+	for name := range extra {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if err := check(fmt.Sprintf("Extra[%q]", name), name, []string{extra[name]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check returns why value is invalid for the option, or "" if it is valid.
+func (info OptionInfo) check(value string) string {
+	switch info.Type {
+	case OptionBool:
+		if value != "true" && value != "false" {
+			return "must be true or false"
+		}
+	case OptionInt:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "must be an integer"
+		}
+		return info.checkRange(float64(n))
+	case OptionFloat:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "must be a number"
+		}
+		return info.checkRange(n)
+	case OptionSize:
+		n, err := parseSize(value)
+		if err != nil {
+			return "must be a size such as 1024, 10K or 20M"
+		}
+		return info.checkRange(float64(n))
+	case OptionEnum:
+		if !slices.Contains(info.Values, value) {
+			return "must be one of " + strings.Join(info.Values, ", ")
+		}
+	}
+	return ""
+}
+
+func (info OptionInfo) checkRange(n float64) string {
+	if n < info.Min {
+		return fmt.Sprintf("must be at least %s", formatBound(info.Type, info.Min))
+	}
+	if n > info.Max {
+		return fmt.Sprintf("must be at most %s", formatBound(info.Type, info.Max))
+	}
+	return ""
+}
+
+func formatBound(t OptionType, n float64) string {
+	if t == OptionSize {
+		switch {
+		case n >= 1<<30 && math.Mod(n, 1<<30) == 0:
+			return strconv.FormatFloat(n/(1<<30), 'f', -1, 64) + "G"
+		case n >= 1<<20 && math.Mod(n, 1<<20) == 0:
+			return strconv.FormatFloat(n/(1<<20), 'f', -1, 64) + "M"
+		case n >= 1<<10 && math.Mod(n, 1<<10) == 0:
+			return strconv.FormatFloat(n/(1<<10), 'f', -1, 64) + "K"
+		}
+	}
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// parseSize parses a size the way aria2 does: a number of bytes with an
+// optional K (1024) or M (1024K) suffix.
+func parseSize(s string) (int64, error) {
+	mul := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"), strings.HasSuffix(s, "k"):
+		mul, s = 1<<10, s[:len(s)-1]
+	case strings.HasSuffix(s, "M"), strings.HasSuffix(s, "m"):
+		mul, s = 1<<20, s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	if n > math.MaxInt64/mul {
+		return 0, fmt.Errorf("size %q overflows", s)
+	}
+	return n * mul, nil
+}
@@ -1,118 +1,441 @@
 package ario
 
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
 // source: https://github.com/siku2/arigo/blob/main/options.go
 // thanks to siku2
 
-// Options represents the aria2 input file options
+// Options represents the aria2 input file options, which can be set per
+// download. see: https://aria2.github.io/manual/en/html/aria2c.html#input-file
+//
+// A nil field is left unset, use Ptr to set a value, e.g. Continue: Ptr(false).
+// All values are sent to aria2 as strings.
 type Options struct {
-	AllProxy                      string   `json:"all-proxy,omitempty"`
-	AllProxyPassword              string   `json:"all-proxy-passwd,omitempty"`
-	AllProxyUser                  string   `json:"all-proxy-user,omitempty"`
-	AllowOverwrite                bool     `json:"allow-overwrite,omitempty,string"`
-	AllowPieceLengthChange        bool     `json:"allow-piece-length-change,omitempty,string"`
-	AlwaysResume                  bool     `json:"always-resume,omitempty,string"`
-	AsyncDNS                      bool     `json:"async-dns,omitempty,string"`
-	AutoFileRenaming              bool     `json:"auto-file-renaming,omitempty,string"`
-	BTEnableHookAfterHashCheck    bool     `json:"bt-enable-hook-after-hash-check,omitempty,string"`
-	BTEnableLpd                   bool     `json:"bt-enable-lpd,omitempty,string"`
-	BTExcludeTracker              string   `json:"bt-exclude-tracker,omitempty"`
-	BTExternalIP                  string   `json:"bt-external-ip,omitempty"`
-	BTForceEncryption             bool     `json:"bt-force-encryption,omitempty,string"`
-	BTHashCheckSeed               bool     `json:"bt-hash-check-seed,omitempty,string"`
-	BTLoadSavedMetadata           bool     `json:"bt-load-saved-metadata,omitempty,string"`
-	BTMaxPeers                    uint     `json:"bt-max-peers,omitempty,string"`
-	BTMetadataOnly                bool     `json:"bt-metadata-only,omitempty,string"`
-	BTMinCryptoLevel              string   `json:"bt-min-crypto-level,omitempty"`
-	BTPrioritizePiece             string   `json:"bt-prioritize-piece,omitempty"`
-	BTRemoveUnselectedFile        bool     `json:"bt-remove-unselected-file,omitempty,string"`
-	BTRequestPeerSpeedLimit       string   `json:"bt-request-peer-speed-limit,omitempty"`
-	BTRequireCrypto               bool     `json:"bt-require-crypto,omitempty,string"`
-	BTSaveMetadata                bool     `json:"bt-save-metadata,omitempty,string"`
-	BTSeedUnverified              bool     `json:"bt-seed-unverified,omitempty,string"`
-	BTStopTimeout                 uint     `json:"bt-stop-timeout,omitempty,string"`
-	BTTracker                     string   `json:"bt-tracker,omitempty"`
-	BTTrackerConnectTimeout       uint     `json:"bt-tracker-connect-timeout,omitempty,string"`
-	BTTrackerInterval             uint     `json:"bt-tracker-interval,omitempty,string"`
-	BTTrackerTimeout              uint     `json:"bt-tracker-timeout,omitempty,string"`
-	CheckIntegrity                bool     `json:"check-integrity,omitempty,string"`
-	Checksum                      string   `json:"checksum,omitempty"`
-	ConditionalGet                bool     `json:"conditional-get,omitempty,string"`
-	ConnectTimeout                uint     `json:"connect-timeout,omitempty,string"`
-	ContentDispositionDefaultUTF8 bool     `json:"content-disposition-default-utf8,omitempty,string"`
-	Continue                      bool     `json:"continue,omitempty,string"`
-	Dir                           string   `json:"dir,omitempty"`
-	DryRun                        bool     `json:"dry-run,omitempty,string"`
-	EnableHTTPKeepAlive           bool     `json:"enable-http-keep-alive,omitempty,string"`
-	EnableHTTPPipelining          bool     `json:"enable-http-pipelining,omitempty,string"`
-	EnableMMap                    bool     `json:"enable-mmap,omitempty,string"`
-	EnablePeerExchange            bool     `json:"enable-peer-exchange,omitempty,string"`
-	FileAllocation                string   `json:"file-allocation,omitempty"`
-	FollowMetalink                bool     `json:"follow-metalink,omitempty,string"`
-	FollowTorrent                 bool     `json:"follow-torrent,omitempty,string"`
-	ForceSave                     bool     `json:"force-save,omitempty,string"`
-	FTPPasswd                     string   `json:"ftp-passwd,omitempty"`
-	FTPPasv                       bool     `json:"ftp-pasv,omitempty,string"`
-	FTPProxy                      string   `json:"ftp-proxy,omitempty"`
-	FTPProxyPasswd                string   `json:"ftp-proxy-passwd,omitempty"`
-	FTPProxyUser                  string   `json:"ftp-proxy-user,omitempty"`
-	FTPReuseConnection            bool     `json:"ftp-reuse-connection,omitempty,string"`
-	FTPType                       string   `json:"ftp-type,omitempty"`
-	FTPUser                       string   `json:"ftp-user,omitempty"`
-	GID                           string   `json:"gid,omitempty"`
-	HashCheckOnly                 bool     `json:"hash-check-only,omitempty,string"`
-	Header                        []string `json:"header,omitempty"`
-	HTTPAcceptGzip                bool     `json:"http-accept-gzip,omitempty,string"`
-	HTTPAuthChallenge             bool     `json:"http-auth-challenge,omitempty,string"`
-	HTTPNoCache                   bool     `json:"http-no-cache,omitempty,string"`
-	HTTPPasswd                    string   `json:"http-passwd,omitempty"`
-	HTTPProxy                     string   `json:"http-proxy,omitempty"`
-	HTTPProxyPasswd               string   `json:"http-proxy-passwd,omitempty"`
-	HTTPProxyUser                 string   `json:"http-proxy-user,omitempty"`
-	HTTPUser                      string   `json:"http-user,omitempty"`
-	HTTPSProxy                    string   `json:"https-proxy,omitempty"`
-	HTTPSProxyPasswd              string   `json:"https-proxy-passwd,omitempty"`
-	HTTPSProxyUser                string   `json:"https-proxy-user,omitempty"`
-	IndexOut                      uint     `json:"index-out,omitempty,string"`
-	LowestSpeedLimit              string   `json:"lowest-speed-limit,omitempty"`
-	MaxConnectionPerServer        uint     `json:"max-connection-per-server,omitempty,string"`
-	MaxDownloadLimit              string   `json:"max-download-limit,omitempty"`
-	MaxFileNotFound               uint     `json:"max-file-not-found,omitempty,string"`
-	MaxMMapLimit                  string   `json:"max-mmap-limit,omitempty"`
-	MaxResumeFailureTries         uint     `json:"max-resume-failure-tries,omitempty,string"`
-	MaxTries                      uint     `json:"max-tries,omitempty,string"`
-	MaxUploadLimit                string   `json:"max-upload-limit,omitempty"`
-	MetalinkBaseURI               string   `json:"metalink-base-uri,omitempty"`
-	MetalinkEnableUniqueProtocol  bool     `json:"metalink-enable-unique-protocol,omitempty,string"`
-	MetalinkLanguage              string   `json:"metalink-language,omitempty"`
-	MetalinkLocation              string   `json:"metalink-location,omitempty"`
-	MetalinkOS                    string   `json:"metalink-os,omitempty"`
-	MetalinkPreferredProtocol     string   `json:"metalink-preferred-protocol,omitempty"`
-	MetalinkVersion               string   `json:"metalink-version,omitempty"`
-	MinSplitSize                  string   `json:"min-split-size,omitempty"`
-	NoFileAllocationLimit         string   `json:"no-file-allocation-limit,omitempty"`
-	NoNetrc                       bool     `json:"no-netrc,omitempty,string"`
-	NoProxy                       bool     `json:"no-proxy,omitempty,string"`
-	Out                           string   `json:"out,omitempty"`
-	ParameterizedURI              string   `json:"parameterized-uri,omitempty"`
-	Pause                         bool     `json:"pause,omitempty,string"`
-	PauseMetadata                 bool     `json:"pause-metadata,omitempty,string"`
-	PieceLength                   string   `json:"piece-length,omitempty"`
-	ProxyMethod                   string   `json:"proxy-method,omitempty"`
-	RealtimeChunkChecksum         string   `json:"realtime-chunk-checksum,omitempty"`
-	Referer                       string   `json:"referer,omitempty"`
-	RemoteTime                    bool     `json:"remote-time,omitempty,string"`
-	RemoveControlFile             string   `json:"remove-control-file,omitempty"`
-	RetryWait                     uint     `json:"retry-wait,omitempty,string"`
-	ReuseURI                      bool     `json:"reuse-uri,omitempty,string"`
-	RPCSaveUploadMetadata         string   `json:"rpc-save-upload-metadata,omitempty"`
-	SeedRatio                     float32  `json:"seed-ratio,omitempty,string"`
-	SeedTime                      uint     `json:"seed-time,omitempty,string"`
-	SelectFile                    string   `json:"select-file,omitempty"`
-	Split                         uint     `json:"split,omitempty,string"`
-	SSHHostKeyMD                  string   `json:"ssh-host-key-md,omitempty"`
-	StreamPieceSelector           string   `json:"stream-piece-selector,omitempty"`
-	Timeout                       uint     `json:"timeout,omitempty,string"`
-	URISelector                   string   `json:"uri-selector,omitempty"`
-	UseHead                       bool     `json:"use-head,omitempty,string"`
-	UserAgent                     string   `json:"user-agent,omitempty"`
+	AllProxy                      *string   `json:"all-proxy"`
+	AllProxyPassword              *string   `json:"all-proxy-passwd"`
+	AllProxyUser                  *string   `json:"all-proxy-user"`
+	AllowOverwrite                *bool     `json:"allow-overwrite"`
+	AllowPieceLengthChange        *bool     `json:"allow-piece-length-change"`
+	AlwaysResume                  *bool     `json:"always-resume"`
+	AsyncDNS                      *bool     `json:"async-dns"`
+	AutoFileRenaming              *bool     `json:"auto-file-renaming"`
+	BTEnableHookAfterHashCheck    *bool     `json:"bt-enable-hook-after-hash-check"`
+	BTEnableLpd                   *bool     `json:"bt-enable-lpd"`
+	BTExcludeTracker              *string   `json:"bt-exclude-tracker"`
+	BTExternalIP                  *string   `json:"bt-external-ip"`
+	BTForceEncryption             *bool     `json:"bt-force-encryption"`
+	BTHashCheckSeed               *bool     `json:"bt-hash-check-seed"`
+	BTLoadSavedMetadata           *bool     `json:"bt-load-saved-metadata"`
+	BTMaxPeers                    *int      `json:"bt-max-peers"`
+	BTMetadataOnly                *bool     `json:"bt-metadata-only"`
+	BTMinCryptoLevel              *string   `json:"bt-min-crypto-level"`
+	BTPrioritizePiece             *string   `json:"bt-prioritize-piece"`
+	BTRemoveUnselectedFile        *bool     `json:"bt-remove-unselected-file"`
+	BTRequestPeerSpeedLimit       *Speed    `json:"bt-request-peer-speed-limit"`
+	BTRequireCrypto               *bool     `json:"bt-require-crypto"`
+	BTSaveMetadata                *bool     `json:"bt-save-metadata"`
+	BTSeedUnverified              *bool     `json:"bt-seed-unverified"`
+	BTStopTimeout                 *Duration `json:"bt-stop-timeout"`
+	BTTracker                     *string   `json:"bt-tracker"`
+	BTTrackerConnectTimeout       *Duration `json:"bt-tracker-connect-timeout"`
+	BTTrackerInterval             *Duration `json:"bt-tracker-interval"`
+	BTTrackerTimeout              *Duration `json:"bt-tracker-timeout"`
+	CheckIntegrity                *bool     `json:"check-integrity"`
+	Checksum                      *string   `json:"checksum"`
+	ConditionalGet                *bool     `json:"conditional-get"`
+	ConnectTimeout                *Duration `json:"connect-timeout"`
+	ContentDispositionDefaultUTF8 *bool     `json:"content-disposition-default-utf8"`
+	Continue                      *bool     `json:"continue"`
+	Dir                           *string   `json:"dir"`
+	DryRun                        *bool     `json:"dry-run"`
+	EnableHTTPKeepAlive           *bool     `json:"enable-http-keep-alive"`
+	EnableHTTPPipelining          *bool     `json:"enable-http-pipelining"`
+	EnableMMap                    *bool     `json:"enable-mmap"`
+	EnablePeerExchange            *bool     `json:"enable-peer-exchange"`
+	FileAllocation                *string   `json:"file-allocation"`
+	FollowMetalink                *string   `json:"follow-metalink"`
+	FollowTorrent                 *string   `json:"follow-torrent"`
+	ForceSave                     *bool     `json:"force-save"`
+	FTPPasswd                     *string   `json:"ftp-passwd"`
+	FTPPasv                       *bool     `json:"ftp-pasv"`
+	FTPProxy                      *string   `json:"ftp-proxy"`
+	FTPProxyPasswd                *string   `json:"ftp-proxy-passwd"`
+	FTPProxyUser                  *string   `json:"ftp-proxy-user"`
+	FTPReuseConnection            *bool     `json:"ftp-reuse-connection"`
+	FTPType                       *string   `json:"ftp-type"`
+	FTPUser                       *string   `json:"ftp-user"`
+	GID                           *string   `json:"gid"`
+	HashCheckOnly                 *bool     `json:"hash-check-only"`
+	Header                        []string  `json:"header"`
+	HTTPAcceptGzip                *bool     `json:"http-accept-gzip"`
+	HTTPAuthChallenge             *bool     `json:"http-auth-challenge"`
+	HTTPNoCache                   *bool     `json:"http-no-cache"`
+	HTTPPasswd                    *string   `json:"http-passwd"`
+	HTTPProxy                     *string   `json:"http-proxy"`
+	HTTPProxyPasswd               *string   `json:"http-proxy-passwd"`
+	HTTPProxyUser                 *string   `json:"http-proxy-user"`
+	HTTPUser                      *string   `json:"http-user"`
+	HTTPSProxy                    *string   `json:"https-proxy"`
+	HTTPSProxyPasswd              *string   `json:"https-proxy-passwd"`
+	HTTPSProxyUser                *string   `json:"https-proxy-user"`
+	IndexOut                      []string  `json:"index-out"`
+	LowestSpeedLimit              *Speed    `json:"lowest-speed-limit"`
+	MaxConnectionPerServer        *int      `json:"max-connection-per-server"`
+	MaxDownloadLimit              *Speed    `json:"max-download-limit"`
+	MaxFileNotFound               *int      `json:"max-file-not-found"`
+	MaxMMapLimit                  *ByteSize `json:"max-mmap-limit"`
+	MaxResumeFailureTries         *int      `json:"max-resume-failure-tries"`
+	MaxTries                      *int      `json:"max-tries"`
+	MaxUploadLimit                *Speed    `json:"max-upload-limit"`
+	MetalinkBaseURI               *string   `json:"metalink-base-uri"`
+	MetalinkEnableUniqueProtocol  *bool     `json:"metalink-enable-unique-protocol"`
+	MetalinkLanguage              *string   `json:"metalink-language"`
+	MetalinkLocation              *string   `json:"metalink-location"`
+	MetalinkOS                    *string   `json:"metalink-os"`
+	MetalinkPreferredProtocol     *string   `json:"metalink-preferred-protocol"`
+	MetalinkVersion               *string   `json:"metalink-version"`
+	MinSplitSize                  *ByteSize `json:"min-split-size"`
+	NoFileAllocationLimit         *ByteSize `json:"no-file-allocation-limit"`
+	NoNetrc                       *bool     `json:"no-netrc"`
+	NoProxy                       *string   `json:"no-proxy"`
+	Out                           *string   `json:"out"`
+	ParameterizedURI              *bool     `json:"parameterized-uri"`
+	Pause                         *bool     `json:"pause"`
+	PauseMetadata                 *bool     `json:"pause-metadata"`
+	PieceLength                   *ByteSize `json:"piece-length"`
+	ProxyMethod                   *string   `json:"proxy-method"`
+	RealtimeChunkChecksum         *bool     `json:"realtime-chunk-checksum"`
+	Referer                       *string   `json:"referer"`
+	RemoteTime                    *bool     `json:"remote-time"`
+	RemoveControlFile             *bool     `json:"remove-control-file"`
+	RetryWait                     *Duration `json:"retry-wait"`
+	ReuseURI                      *bool     `json:"reuse-uri"`
+	RPCSaveUploadMetadata         *bool     `json:"rpc-save-upload-metadata"`
+	SeedRatio                     *float64  `json:"seed-ratio"`
+	SeedTime                      *Duration `json:"seed-time" unit:"minute"`
+	SelectFile                    *string   `json:"select-file"`
+	Split                         *int      `json:"split"`
+	SSHHostKeyMD                  *string   `json:"ssh-host-key-md"`
+	StreamPieceSelector           *string   `json:"stream-piece-selector"`
+	Timeout                       *Duration `json:"timeout"`
+	URISelector                   *string   `json:"uri-selector"`
+	UseHead                       *bool     `json:"use-head"`
+	UserAgent                     *string   `json:"user-agent"`
+
+	// Extra holds the options that have no field, they are sent as is and
+	// receive the unknown keys when decoding.
+	Extra map[string]string `json:"-"`
+}
+
+// GlobalOptions represents the options returned by aria2.getGlobalOption and
+// accepted by aria2.changeGlobalOption: the input file options, which are
+// the defaults of new downloads, and the options of aria2 itself. Only some
+// of them can be changed at runtime, see the manual.
+type GlobalOptions struct {
+	Options
+
+	AsyncDNSServer               *string   `json:"async-dns-server"`
+	AutoSaveInterval             *Duration `json:"auto-save-interval"`
+	BTDetachSeedOnly             *bool     `json:"bt-detach-seed-only"`
+	BTLPDInterface               *string   `json:"bt-lpd-interface"`
+	BTMaxOpenFiles               *int      `json:"bt-max-open-files"`
+	CACertificate                *string   `json:"ca-certificate"`
+	Certificate                  *string   `json:"certificate"`
+	CheckCertificate             *bool     `json:"check-certificate"`
+	ConfPath                     *string   `json:"conf-path"`
+	ConsoleLogLevel              *string   `json:"console-log-level"`
+	Daemon                       *bool     `json:"daemon"`
+	DeferredInput                *bool     `json:"deferred-input"`
+	DHTEntryPoint                *string   `json:"dht-entry-point"`
+	DHTEntryPoint6               *string   `json:"dht-entry-point6"`
+	DHTFilePath                  *string   `json:"dht-file-path"`
+	DHTFilePath6                 *string   `json:"dht-file-path6"`
+	DHTListenAddr6               *string   `json:"dht-listen-addr6"`
+	DHTListenPort                *string   `json:"dht-listen-port"`
+	DHTMessageTimeout            *Duration `json:"dht-message-timeout"`
+	DisableIPv6                  *bool     `json:"disable-ipv6"`
+	DiskCache                    *ByteSize `json:"disk-cache"`
+	DownloadResult               *string   `json:"download-result"`
+	DSCP                         *int      `json:"dscp"`
+	EnableColor                  *bool     `json:"enable-color"`
+	EnableDHT                    *bool     `json:"enable-dht"`
+	EnableDHT6                   *bool     `json:"enable-dht6"`
+	EnableRPC                    *bool     `json:"enable-rpc"`
+	EventPoll                    *string   `json:"event-poll"`
+	ForceSequential              *bool     `json:"force-sequential"`
+	HumanReadable                *bool     `json:"human-readable"`
+	InputFile                    *string   `json:"input-file"`
+	Interface                    *string   `json:"interface"`
+	KeepUnfinishedDownloadResult *bool     `json:"keep-unfinished-download-result"`
+	ListenPort                   *string   `json:"listen-port"`
+	LoadCookies                  *string   `json:"load-cookies"`
+	Log                          *string   `json:"log"`
+	LogLevel                     *string   `json:"log-level"`
+	MaxConcurrentDownloads       *int      `json:"max-concurrent-downloads"`
+	MaxDownloadResult            *int      `json:"max-download-result"`
+	MaxOverallDownloadLimit      *Speed    `json:"max-overall-download-limit"`
+	MaxOverallUploadLimit        *Speed    `json:"max-overall-upload-limit"`
+	MinTLSVersion                *string   `json:"min-tls-version"`
+	MultipleInterface            *string   `json:"multiple-interface"`
+	NetrcPath                    *string   `json:"netrc-path"`
+	OnBTDownloadComplete         *string   `json:"on-bt-download-complete"`
+	OnDownloadComplete           *string   `json:"on-download-complete"`
+	OnDownloadError              *string   `json:"on-download-error"`
+	OnDownloadPause              *string   `json:"on-download-pause"`
+	OnDownloadStart              *string   `json:"on-download-start"`
+	OnDownloadStop               *string   `json:"on-download-stop"`
+	OptimizeConcurrentDownloads  *string   `json:"optimize-concurrent-downloads"`
+	PeerAgent                    *string   `json:"peer-agent"`
+	PeerIDPrefix                 *string   `json:"peer-id-prefix"`
+	PrivateKey                   *string   `json:"private-key"`
+	Quiet                        *bool     `json:"quiet"`
+	RlimitNofile                 *int      `json:"rlimit-nofile"`
+	RPCAllowOriginAll            *bool     `json:"rpc-allow-origin-all"`
+	RPCCertificate               *string   `json:"rpc-certificate"`
+	RPCListenAll                 *bool     `json:"rpc-listen-all"`
+	RPCListenPort                *int      `json:"rpc-listen-port"`
+	RPCMaxRequestSize            *ByteSize `json:"rpc-max-request-size"`
+	RPCPasswd                    *string   `json:"rpc-passwd"`
+	RPCPrivateKey                *string   `json:"rpc-private-key"`
+	RPCSecret                    *string   `json:"rpc-secret"`
+	RPCSecure                    *bool     `json:"rpc-secure"`
+	RPCUser                      *string   `json:"rpc-user"`
+	SaveCookies                  *string   `json:"save-cookies"`
+	SaveNotFound                 *bool     `json:"save-not-found"`
+	SaveSession                  *string   `json:"save-session"`
+	SaveSessionInterval          *Duration `json:"save-session-interval"`
+	ServerStatIf                 *string   `json:"server-stat-if"`
+	ServerStatOf                 *string   `json:"server-stat-of"`
+	ServerStatTimeout            *Duration `json:"server-stat-timeout"`
+	SocketRecvBufferSize         *ByteSize `json:"socket-recv-buffer-size"`
+	Stderr                       *bool     `json:"stderr"`
+	Stop                         *int      `json:"stop"`
+	StopWithProcess              *int      `json:"stop-with-process"`
+	SummaryInterval              *Duration `json:"summary-interval"`
+	TruncateConsoleReadout       *bool     `json:"truncate-console-readout"`
+}
+
+// Ptr returns a pointer to v, to set a field of Options.
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+func (o Options) MarshalJSON() ([]byte, error) {
+	return marshalOptions(reflect.ValueOf(o), o.Extra)
+}
+
+func (o *Options) UnmarshalJSON(data []byte) error {
+	return unmarshalOptions(data, reflect.ValueOf(o).Elem(), &o.Extra)
+}
+
+func (o GlobalOptions) MarshalJSON() ([]byte, error) {
+	return marshalOptions(reflect.ValueOf(o), o.Extra)
+}
+
+func (o *GlobalOptions) UnmarshalJSON(data []byte) error {
+	return unmarshalOptions(data, reflect.ValueOf(o).Elem(), &o.Extra)
+}
+
+// optionFields calls fn with the description, the key and the value of each
+// option field of v, including the fields of embedded structs.
+func optionFields(v reflect.Value, fn func(sf reflect.StructField, key string, f reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Anonymous {
+			if err := optionFields(v.Field(i), fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		key, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		if err := fn(sf, key, v.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func marshalOptions(v reflect.Value, extra map[string]string) ([]byte, error) {
+	m := make(map[string]any, len(extra))
+	for k, s := range extra {
+		m[k] = s
+	}
+
+	err := optionFields(v, func(sf reflect.StructField, key string, f reflect.Value) error {
+		if f.IsNil() {
+			return nil
+		}
+		if f.Kind() == reflect.Slice {
+			m[key] = f.Interface()
+			return nil
+		}
+
+		s, err := formatOption(sf, f)
+		if err != nil {
+			return fmt.Errorf("option %s: %w", key, err)
+		}
+		m[key] = s
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(m)
+}
+
+var durationType = reflect.TypeFor[*Duration]()
+
+// durationUnit returns the unit of a Duration field, seconds unless its unit
+// tag is "minute".
+func durationUnit(sf reflect.StructField) time.Duration {
+	if sf.Tag.Get("unit") == "minute" {
+		return time.Minute
+	}
+	return time.Second
+}
+
+// formatOption returns the value pointed to by f as aria2 expects it.
+func formatOption(sf reflect.StructField, f reflect.Value) (string, error) {
+	if f.Type() == durationType {
+		return formatDuration(*f.Interface().(*Duration), durationUnit(sf)), nil
+	}
+	if m, ok := f.Interface().(encoding.TextMarshaler); ok {
+		b, err := m.MarshalText()
+		return string(b), err
+	}
+
+	e := f.Elem()
+	switch e.Kind() {
+	case reflect.String:
+		return e.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(e.Bool()), nil
+	case reflect.Int, reflect.Int64:
+		return strconv.FormatInt(e.Int(), 10), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(e.Float(), 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("unsupported type %s", f.Type())
+}
+
+func unmarshalOptions(data []byte, v reflect.Value, extra *map[string]string) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+
+	err := optionFields(v, func(sf reflect.StructField, key string, f reflect.Value) error {
+		raw, ok := m[key]
+		if !ok {
+			return nil
+		}
+		delete(m, key)
+
+		if err := parseOption(raw, sf, f); err != nil {
+			return fmt.Errorf("option %s: %w", key, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// keep the unknown options, so that they are sent back as is
+	*extra = nil
+	for k, raw := range m {
+		if *extra == nil {
+			*extra = make(map[string]string, len(m))
+		}
+		(*extra)[k] = optionString(raw)
+	}
+	return nil
+}
+
+// parseOption sets f from raw, a JSON string as sent by aria2 or a plain
+// JSON value. Lists are sent as arrays or as strings joined with newlines.
+func parseOption(raw json.RawMessage, sf reflect.StructField, f reflect.Value) error {
+	if f.Kind() == reflect.Slice {
+		var list []string
+		if err := json.Unmarshal(raw, &list); err == nil {
+			f.Set(reflect.ValueOf(list))
+			return nil
+		}
+		if s := optionString(raw); s != "" {
+			f.Set(reflect.ValueOf(strings.Split(s, "\n")))
+		}
+		return nil
+	}
+
+	s := optionString(raw)
+	p := reflect.New(f.Type().Elem())
+
+	if f.Type() == durationType {
+		d, err := parseDuration(s, durationUnit(sf))
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(&d))
+		return nil
+	}
+
+	if u, ok := p.Interface().(encoding.TextUnmarshaler); ok {
+		if err := u.UnmarshalText([]byte(s)); err != nil {
+			return err
+		}
+		f.Set(p)
+		return nil
+	}
+
+	e := p.Elem()
+	switch e.Kind() {
+	case reflect.String:
+		e.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		e.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		e.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		e.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %s", f.Type())
+	}
+
+	f.Set(p)
+	return nil
+}
+
+// optionString returns the content of a JSON string, or the JSON text of
+// other values.
+func optionString(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
 }
@@ -0,0 +1,270 @@
+package ario
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kahosan/aria2-rpc/resp"
+)
+
+// MinPollInterval is the shortest interval of a Poller with an adaptive
+// interval.
+const MinPollInterval = 10 * time.Millisecond
+
+// PollerOption configures a Poller created by NewPoller.
+type PollerOption func(*pollerConfig)
+
+type pollerConfig struct {
+	keys     []string
+	interval time.Duration
+	min, max time.Duration // adaptive interval, if max > 0
+}
+
+// WithPollKeys sets the keys of aria2.tellStatus to fetch, all of them by
+// default. gid and status are always fetched, as well as totalLength,
+// completedLength and downloadSpeed with an adaptive interval.
+func WithPollKeys(keys ...string) PollerOption {
+	return func(c *pollerConfig) { c.keys = keys }
+}
+
+// WithPollInterval sets a fixed polling interval, DefaultTaskInterval by
+// default or if d is not positive.
+func WithPollInterval(d time.Duration) PollerOption {
+	return func(c *pollerConfig) { c.interval, c.min, c.max = d, 0, 0 }
+}
+
+// WithAdaptiveInterval polls faster as downloads get close to completion: the
+// interval is a tenth of the shortest estimated time left of the active
+// downloads, bounded by min and max. It is max when no download is active.
+// min is at least MinPollInterval, and max at least min.
+func WithAdaptiveInterval(min, max time.Duration) PollerOption {
+	if min < MinPollInterval {
+		min = MinPollInterval
+	}
+	if max < min {
+		max = min
+	}
+	return func(c *pollerConfig) { c.min, c.max = min, max }
+}
+
+// PollEvent is a change reported by a Poller.
+type PollEvent struct {
+	Gid     string
+	Status  resp.Status // the fetched keys
+	Changed []string    // the keys that changed since the previous poll, all of them the first time
+	// Err is why Gid could not be polled, or why no download could be polled
+	// if Gid is empty. A download that is not found wraps ErrGIDNotFound.
+	Err error
+}
+
+// Poller polls the status of many downloads, with a single system.multicall
+// per tick, and reports the downloads that changed.
+type Poller struct {
+	c   *Client
+	cfg pollerConfig
+
+	mu   sync.Mutex
+	gids []string
+	last map[string]map[string]json.RawMessage // the values of the previous poll
+}
+
+// NewPoller returns a poller of no download, see Add.
+func (c *Client) NewPoller(opts ...PollerOption) *Poller {
+	cfg := pollerConfig{interval: DefaultTaskInterval}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.interval <= 0 {
+		cfg.interval = DefaultTaskInterval
+	}
+
+	if len(cfg.keys) > 0 {
+		required := []string{"gid", "status"}
+		if cfg.max > 0 {
+			required = append(required, "totalLength", "completedLength", "downloadSpeed")
+		}
+		for _, k := range required {
+			if !slices.Contains(cfg.keys, k) {
+				cfg.keys = append(cfg.keys, k)
+			}
+		}
+	}
+
+	return &Poller{c: c, cfg: cfg, last: make(map[string]map[string]json.RawMessage)}
+}
+
+// Add starts polling gids.
+func (p *Poller) Add(gids ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, gid := range gids {
+		if !slices.Contains(p.gids, gid) {
+			p.gids = append(p.gids, gid)
+		}
+	}
+}
+
+// Remove stops polling gids.
+func (p *Poller) Remove(gids ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.removeLocked(gids...)
+}
+
+func (p *Poller) removeLocked(gids ...string) {
+	p.gids = slices.DeleteFunc(p.gids, func(gid string) bool { return slices.Contains(gids, gid) })
+	for _, gid := range gids {
+		delete(p.last, gid)
+	}
+}
+
+// GIDs returns the polled downloads.
+func (p *Poller) GIDs() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.gids)
+}
+
+// Run polls the downloads until ctx ends, and sends the changes to the
+// returned channel, which is closed when ctx ends. A download is no longer
+// polled once it stopped or was not found, after its last event.
+func (p *Poller) Run(ctx context.Context) <-chan PollEvent {
+	ch := make(chan PollEvent)
+
+	go func() {
+		defer close(ch)
+
+		for {
+			events, next := p.Poll(ctx)
+			for _, e := range events {
+				select {
+				case ch <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			timer := time.NewTimer(next)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// Poll polls the downloads once, and returns the changes and the interval
+// until the next poll. It is called by Run.
+func (p *Poller) Poll(ctx context.Context) ([]PollEvent, time.Duration) {
+	gids := p.GIDs()
+	if len(gids) == 0 {
+		return nil, p.interval(nil)
+	}
+
+	b := p.c.NewBatch()
+	futures := make([]*Future[map[string]json.RawMessage], len(gids))
+	for i, gid := range gids {
+		futures[i] = Queue[map[string]json.RawMessage](b, method.TellStatus, gid, p.cfg.keys)
+	}
+	if err := b.RunContext(ctx); err != nil {
+		return []PollEvent{{Err: err}}, p.interval(nil)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var (
+		events   []PollEvent
+		statuses []resp.Status
+		done     []string
+	)
+	for i, gid := range gids {
+		if !slices.Contains(p.gids, gid) {
+			// removed in the meantime
+			continue
+		}
+
+		fields, err := futures[i].Get()
+		if err == nil {
+			var s resp.Status
+			if err = decodeFields(fields, &s); err == nil {
+				statuses = append(statuses, s)
+				if changed := p.diffLocked(gid, fields); len(changed) > 0 {
+					events = append(events, PollEvent{Gid: gid, Status: s, Changed: changed})
+				}
+				if s.Status.Stopped() {
+					done = append(done, gid)
+				}
+				continue
+			}
+		}
+
+		events = append(events, PollEvent{Gid: gid, Err: err})
+		if errors.Is(err, ErrGIDNotFound) {
+			done = append(done, gid)
+		}
+	}
+	p.removeLocked(done...)
+
+	return events, p.interval(statuses)
+}
+
+// diffLocked returns the keys of fields whose value changed, and records
+// them.
+func (p *Poller) diffLocked(gid string, fields map[string]json.RawMessage) []string {
+	last, ok := p.last[gid]
+	p.last[gid] = fields
+
+	var changed []string
+	for k, v := range fields {
+		if old, found := last[k]; !ok || !found || !bytes.Equal(old, v) {
+			changed = append(changed, k)
+		}
+	}
+	for k := range last {
+		if _, found := fields[k]; !found {
+			changed = append(changed, k)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+// interval returns the time until the next poll.
+func (p *Poller) interval(statuses []resp.Status) time.Duration {
+	if p.cfg.max <= 0 {
+		return p.cfg.interval
+	}
+
+	next := p.cfg.max
+	for _, s := range statuses {
+		if s.Status != resp.StatusActive || s.DownloadSpeed <= 0 || s.TotalLength <= s.CompletedLength {
+			continue
+		}
+		left := time.Duration(float64(s.TotalLength-s.CompletedLength) / float64(s.DownloadSpeed) * float64(time.Second))
+		next = min(next, left/10)
+	}
+	return max(next, p.cfg.min)
+}
+
+func decodeFields(fields map[string]json.RawMessage, s *resp.Status) error {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return fmt.Errorf("%s: %w", method.TellStatus, err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package resp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kahosan/aria2-rpc/internal/units"
+)
+
+// Speed is a transfer rate measured in bytes/sec.
+type Speed int64
+
+func (s *Speed) UnmarshalJSON(data []byte) error {
+	var n number
+	if err := n.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	*s = Speed(n)
+	return nil
+}
+
+// String formats the speed with binary units, e.g. "1.5MiB/s".
+func (s Speed) String() string {
+	return units.Bytes(int64(s)) + "B/s"
+}
+
+// unquote strips the quotes of a string-encoded value. null and the empty
+// string are reported as nil.
+func unquote(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil, nil
+	}
+
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, err
+		}
+		if s == "" {
+			return nil, nil
+		}
+		return []byte(s), nil
+	}
+
+	return data, nil
+}
+
+// number decodes an integer given either as a JSON number or as a string.
+type number int64
+
+func (n *number) UnmarshalJSON(data []byte) error {
+	v, err := unquote(data)
+	if err != nil || v == nil {
+		return err
+	}
+
+	i, err := strconv.ParseInt(string(v), 10, 64)
+	if err != nil {
+		f, ferr := strconv.ParseFloat(string(v), 64)
+		if ferr != nil {
+			return fmt.Errorf("resp: invalid number %s", data)
+		}
+		i = int64(f)
+	}
+
+	*n = number(i)
+	return nil
+}
+
+// boolean decodes a boolean given either as a JSON bool or as a string.
+type boolean bool
+
+func (b *boolean) UnmarshalJSON(data []byte) error {
+	v, err := unquote(data)
+	if err != nil || v == nil {
+		return err
+	}
+
+	p, err := strconv.ParseBool(string(v))
+	if err != nil {
+		return fmt.Errorf("resp: invalid boolean %s", data)
+	}
+
+	*b = boolean(p)
+	return nil
+}
+
+// timestamp decodes a time given as seconds since the epoch, either as a JSON
+// number or as a string. RFC 3339 strings are accepted as well.
+type timestamp time.Time
+
+func (t *timestamp) UnmarshalJSON(data []byte) error {
+	v, err := unquote(data)
+	if err != nil || v == nil {
+		return err
+	}
+
+	if sec, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+		*t = timestamp(time.Unix(sec, 0))
+		return nil
+	}
+
+	p, err := time.Parse(time.RFC3339, string(v))
+	if err != nil {
+		return fmt.Errorf("resp: invalid timestamp %s", data)
+	}
+
+	*t = timestamp(p)
+	return nil
+}
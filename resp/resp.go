@@ -0,0 +1,260 @@
+// Package resp contains the types of the responses returned by aria2.
+//
+// aria2 encodes most numbers and booleans as strings, the types in this
+// package decode them into their natural Go types. Decoding is lenient and
+// accepts both the string-encoded and the plain JSON values.
+package resp
+
+// source: https://github.com/alist-org/alist/blob/main/pkg/aria2/rpc/resp.go
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DownloadStatus is the state of a download.
+type DownloadStatus string
+
+const (
+	StatusActive   DownloadStatus = "active"   // currently downloading/seeding downloads.
+	StatusWaiting  DownloadStatus = "waiting"  // downloads in the queue; download is not started.
+	StatusPaused   DownloadStatus = "paused"   // paused downloads.
+	StatusError    DownloadStatus = "error"    // downloads that were stopped because of error.
+	StatusComplete DownloadStatus = "complete" // stopped and completed downloads.
+	StatusRemoved  DownloadStatus = "removed"  // the downloads removed by user.
+)
+
+// Stopped reports whether the download is stopped, i.e. it is complete, failed or removed.
+func (s DownloadStatus) Stopped() bool {
+	return s == StatusError || s == StatusComplete || s == StatusRemoved
+}
+
+// Status represents response of aria2.tellStatus
+type Status struct {
+	Gid                    string         `json:"gid"`                    // GID of the download.
+	Status                 DownloadStatus `json:"status"`                 // active for currently downloading/seeding downloads. waiting for downloads in the queue; download is not started. paused for paused downloads. error for downloads that were stopped because of error. complete for stopped and completed downloads. removed for the downloads removed by user.
+	TotalLength            int64          `json:"totalLength"`            // Total length of the download in bytes.
+	CompletedLength        int64          `json:"completedLength"`        // Completed length of the download in bytes.
+	UploadLength           int64          `json:"uploadLength"`           // Uploaded length of the download in bytes.
+	BitField               string         `json:"bitfield"`               // Hexadecimal representation of the download progress. The highest bit corresponds to the piece at index 0. Any set bits indicate loaded pieces, while unset bits indicate not yet loaded and/or missing pieces. Any overflow bits at the end are set to zero. When the download was not started yet, this key will not be included in the response.
+	DownloadSpeed          Speed          `json:"downloadSpeed"`          // Download speed of this download measured in bytes/sec.
+	UploadSpeed            Speed          `json:"uploadSpeed"`            // Upload speed of this download measured in bytes/sec.
+	InfoHash               string         `json:"infoHash"`               // InfoHash. BitTorrent only.
+	NumSeeders             int            `json:"numSeeders"`             // The number of seeders aria2 has connected to. BitTorrent only.
+	Seeder                 bool           `json:"seeder"`                 // true if the local endpoint is a seeder. Otherwise, false. BitTorrent only.
+	PieceLength            int64          `json:"pieceLength"`            // Piece length in bytes.
+	NumPieces              int            `json:"numPieces"`              // The number of pieces.
+	Connections            int            `json:"connections"`            // The number of peers/servers aria2 has connected to.
+	ErrorCode              int            `json:"errorCode"`              // The code of the last error for this item, if any. The error codes are defined in the EXIT STATUS section. This value is only available for stopped/completed downloads.
+	ErrorMessage           string         `json:"errorMessage"`           // The (hopefully) human-readable error message associated to errorCode.
+	FollowedBy             []string       `json:"followedBy"`             // List of GIDs which are generated as the result of this download. For example, when aria2 downloads a Metalink file, it generates downloads described in the Metalink (see the --follow-metalink option). This value is useful to track auto-generated downloads. If there are no such downloads, this key will not be included in the response.
+	Following              string         `json:"following"`              // The reverse link for followedBy. A download included in followedBy has this object's GID in its following value.
+	BelongsTo              string         `json:"belongsTo"`              // GID of a parent download. Some downloads are a part of another download. For example, if a file in a Metalink has BitTorrent resources, the downloads of ".torrent" files are parts of that parent. If this download has no parent, this key will not be included in the response.
+	Dir                    string         `json:"dir"`                    // Directory to save files.
+	Files                  []Files        `json:"files"`                  // Returns the list of files. The elements of this list are the same structs used in aria2.getFiles() method.
+	VerifiedLength         int64          `json:"verifiedLength"`         // The number of verified number of bytes while the files are being hash checked. This key exists only when this download is being hash checked.
+	VerifyIntegrityPending bool           `json:"verifyIntegrityPending"` // true if this download is waiting for the hash check in a queue. This key exists only when this download is in the queue.
+	BitTorrent             BitTorrent     `json:"bittorrent"`             // Struct which contains information retrieved from the .torrent (file). BitTorrent only. It contains following keys.
+}
+
+func (s *Status) UnmarshalJSON(data []byte) error {
+	type plain Status
+	v := struct {
+		*plain
+		TotalLength            number  `json:"totalLength"`
+		CompletedLength        number  `json:"completedLength"`
+		UploadLength           number  `json:"uploadLength"`
+		NumSeeders             number  `json:"numSeeders"`
+		Seeder                 boolean `json:"seeder"`
+		PieceLength            number  `json:"pieceLength"`
+		NumPieces              number  `json:"numPieces"`
+		Connections            number  `json:"connections"`
+		ErrorCode              number  `json:"errorCode"`
+		VerifiedLength         number  `json:"verifiedLength"`
+		VerifyIntegrityPending boolean `json:"verifyIntegrityPending"`
+	}{plain: (*plain)(s)}
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	s.TotalLength = int64(v.TotalLength)
+	s.CompletedLength = int64(v.CompletedLength)
+	s.UploadLength = int64(v.UploadLength)
+	s.NumSeeders = int(v.NumSeeders)
+	s.Seeder = bool(v.Seeder)
+	s.PieceLength = int64(v.PieceLength)
+	s.NumPieces = int(v.NumPieces)
+	s.Connections = int(v.Connections)
+	s.ErrorCode = int(v.ErrorCode)
+	s.VerifiedLength = int64(v.VerifiedLength)
+	s.VerifyIntegrityPending = bool(v.VerifyIntegrityPending)
+	return nil
+}
+
+// BitTorrent represents the bittorrent struct in the response of aria2.tellStatus
+type BitTorrent struct {
+	AnnounceList [][]string `json:"announceList"` // List of lists of announce URIs. If the torrent contains announce and no announce-list, announce is converted to the announce-list format.
+	Comment      string     `json:"comment"`      // The comment of the torrent. comment.utf-8 is used if available.
+	CreationDate time.Time  `json:"creationDate"` // The creation time of the torrent.
+	Mode         string     `json:"mode"`         // File mode of the torrent. The value is either single or multi.
+	Info         struct {
+		Name string `json:"name"` // name in info dictionary. name.utf-8 is used if available.
+	} `json:"info"` // Struct which contains data from Info dictionary. It contains following keys.
+}
+
+func (b *BitTorrent) UnmarshalJSON(data []byte) error {
+	type plain BitTorrent
+	v := struct {
+		*plain
+		CreationDate timestamp `json:"creationDate"`
+	}{plain: (*plain)(b)}
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	b.CreationDate = time.Time(v.CreationDate)
+	return nil
+}
+
+// URIs represents an element of response of aria2.getUris
+type URIs struct {
+	URI    string `json:"uri"`    // URI
+	Status string `json:"status"` // 'used' if the URI is in use. 'waiting' if the URI is still waiting in the queue.
+}
+
+// Files represents an element of response of aria2.getFiles
+type Files struct {
+	Index           int    `json:"index"`           // Index of the file, starting at 1, in the same order as files appear in the multi-file torrent.
+	Path            string `json:"path"`            // File path.
+	Length          int64  `json:"length"`          // File size in bytes.
+	CompletedLength int64  `json:"completedLength"` // Completed length of this file in bytes. Please note that it is possible that sum of completedLength is less than the completedLength returned by the aria2.tellStatus() method. This is because completedLength in aria2.getFiles() only includes completed pieces. On the other hand, completedLength in aria2.tellStatus() also includes partially completed pieces.
+	Selected        bool   `json:"selected"`        // true if this file is selected by --select-file option. If --select-file is not specified or this is single-file torrent or not a torrent download at all, this value is always true. Otherwise false.
+	URIs            []URIs `json:"uris"`            // Returns a list of URIs for this file. The element type is the same struct used in the aria2.getUris() method.
+}
+
+func (f *Files) UnmarshalJSON(data []byte) error {
+	type plain Files
+	v := struct {
+		*plain
+		Index           number  `json:"index"`
+		Length          number  `json:"length"`
+		CompletedLength number  `json:"completedLength"`
+		Selected        boolean `json:"selected"`
+	}{plain: (*plain)(f)}
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	f.Index = int(v.Index)
+	f.Length = int64(v.Length)
+	f.CompletedLength = int64(v.CompletedLength)
+	f.Selected = bool(v.Selected)
+	return nil
+}
+
+// Peers represents an element of response of aria2.getPeers
+type Peers struct {
+	PeerId        string `json:"peerId"`        // Percent-encoded peer ID.
+	IP            string `json:"ip"`            // IP address of the peer.
+	Port          int    `json:"port"`          // Port number of the peer.
+	BitField      string `json:"bitfield"`      // Hexadecimal representation of the download progress of the peer. The highest bit corresponds to the piece at index 0. Set bits indicate the piece is available and unset bits indicate the piece is missing. Any spare bits at the end are set to zero.
+	AmChoking     bool   `json:"amChoking"`     // true if aria2 is choking the peer. Otherwise false.
+	PeerChoking   bool   `json:"peerChoking"`   // true if the peer is choking aria2. Otherwise false.
+	DownloadSpeed Speed  `json:"downloadSpeed"` // Download speed (byte/sec) that this client obtains from the peer.
+	UploadSpeed   Speed  `json:"uploadSpeed"`   // Upload speed(byte/sec) that this client uploads to the peer.
+	Seeder        bool   `json:"seeder"`        // true if this peer is a seeder. Otherwise false.
+}
+
+func (p *Peers) UnmarshalJSON(data []byte) error {
+	type plain Peers
+	v := struct {
+		*plain
+		Port        number  `json:"port"`
+		AmChoking   boolean `json:"amChoking"`
+		PeerChoking boolean `json:"peerChoking"`
+		Seeder      boolean `json:"seeder"`
+	}{plain: (*plain)(p)}
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	p.Port = int(v.Port)
+	p.AmChoking = bool(v.AmChoking)
+	p.PeerChoking = bool(v.PeerChoking)
+	p.Seeder = bool(v.Seeder)
+	return nil
+}
+
+// Servers represents an element of response of aria2.getServers
+type Servers struct {
+	Index   int      `json:"index"`   // Index of the file, starting at 1, in the same order as files appear in the multi-file metalink.
+	Servers []Server `json:"servers"` // A list of structs which contain the following keys.
+}
+
+func (s *Servers) UnmarshalJSON(data []byte) error {
+	type plain Servers
+	v := struct {
+		*plain
+		Index number `json:"index"`
+	}{plain: (*plain)(s)}
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	s.Index = int(v.Index)
+	return nil
+}
+
+// Server represents an element of Servers.Servers
+type Server struct {
+	URI           string `json:"uri"`           // Original URI.
+	CurrentURI    string `json:"currentUri"`    // This is the URI currently used for downloading. If redirection is involved, currentUri and uri may differ.
+	DownloadSpeed Speed  `json:"downloadSpeed"` // Download speed (byte/sec)
+}
+
+// GlobalStat represents response of aria2.getGlobalStat
+type GlobalStat struct {
+	DownloadSpeed   Speed `json:"downloadSpeed"`   // Overall download speed (byte/sec).
+	UploadSpeed     Speed `json:"uploadSpeed"`     // Overall upload speed(byte/sec).
+	NumActive       int   `json:"numActive"`       // The number of active downloads.
+	NumWaiting      int   `json:"numWaiting"`      // The number of waiting downloads.
+	NumStopped      int   `json:"numStopped"`      // The number of stopped downloads in the current session. This value is capped by the --max-download-result option.
+	NumStoppedTotal int   `json:"numStoppedTotal"` // The number of stopped downloads in the current session and not capped by the --max-download-result option.
+}
+
+func (g *GlobalStat) UnmarshalJSON(data []byte) error {
+	type plain GlobalStat
+	v := struct {
+		*plain
+		NumActive       number `json:"numActive"`
+		NumWaiting      number `json:"numWaiting"`
+		NumStopped      number `json:"numStopped"`
+		NumStoppedTotal number `json:"numStoppedTotal"`
+	}{plain: (*plain)(g)}
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	g.NumActive = int(v.NumActive)
+	g.NumWaiting = int(v.NumWaiting)
+	g.NumStopped = int(v.NumStopped)
+	g.NumStoppedTotal = int(v.NumStoppedTotal)
+	return nil
+}
+
+// Version represents response of aria2.getVersion
+type Version struct {
+	Version  string   `json:"version"`         // Version number of aria2 as a string.
+	Features []string `json:"enabledFeatures"` // List of enabled features. Each feature is given as a string.
+}
+
+// SessionInfo represents response of aria2.getSessionInfo
+type SessionInfo struct {
+	Id string `json:"sessionId"` // Session ID, which is generated each time when aria2 is invoked.
+}
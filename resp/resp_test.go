@@ -0,0 +1,67 @@
+package resp_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kahosan/aria2-rpc/resp"
+)
+
+func TestStatus(t *testing.T) {
+	t.Run("string encoded values", func(t *testing.T) {
+		data := `{
+			"gid": "2089b05ecca3d829",
+			"status": "active",
+			"totalLength": "34896138",
+			"completedLength": "34896138",
+			"downloadSpeed": "1572864",
+			"seeder": "true",
+			"numPieces": "34",
+			"errorCode": "0",
+			"files": [{"index": "1", "length": "34896138", "selected": "true"}],
+			"bittorrent": {"creationDate": 1672531200}
+		}`
+
+		var s resp.Status
+		if err := json.Unmarshal([]byte(data), &s); err != nil {
+			t.Fatal(err)
+		}
+
+		if s.Status != resp.StatusActive || s.TotalLength != 34896138 || s.NumPieces != 34 || !s.Seeder {
+			t.Fatal("unexpected status: ", s)
+		}
+
+		if s.DownloadSpeed.String() != "1.5MiB/s" {
+			t.Fatal("unexpected speed: ", s.DownloadSpeed)
+		}
+
+		if len(s.Files) != 1 || s.Files[0].Index != 1 || !s.Files[0].Selected {
+			t.Fatal("unexpected files: ", s.Files)
+		}
+
+		if !s.BitTorrent.CreationDate.Equal(time.Unix(1672531200, 0)) {
+			t.Fatal("unexpected creation date: ", s.BitTorrent.CreationDate)
+		}
+	})
+
+	t.Run("plain values", func(t *testing.T) {
+		data := `{"gid": "2089b05ecca3d829", "status": "error", "totalLength": 1024, "seeder": false, "errorCode": 3}`
+
+		var s resp.Status
+		if err := json.Unmarshal([]byte(data), &s); err != nil {
+			t.Fatal(err)
+		}
+
+		if !s.Status.Stopped() || s.TotalLength != 1024 || s.ErrorCode != 3 {
+			t.Fatal("unexpected status: ", s)
+		}
+	})
+
+	t.Run("invalid number", func(t *testing.T) {
+		var s resp.GlobalStat
+		if err := json.Unmarshal([]byte(`{"numActive": "many"}`), &s); err == nil {
+			t.Fatal("should error")
+		}
+	})
+}
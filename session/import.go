@@ -0,0 +1,79 @@
+package session
+
+import (
+	"context"
+
+	ario "github.com/kahosan/aria2-rpc"
+)
+
+// DefaultChunkSize is the number of downloads added per system.multicall.
+const DefaultChunkSize = 100
+
+// Result is the outcome of the import of an entry.
+type Result struct {
+	Entry int    // index of the entry
+	GID   string // GID of the new download
+	Err   error  // why the entry could not be added
+}
+
+// ImportOption configures Import.
+type ImportOption func(*importConfig)
+
+type importConfig struct {
+	chunkSize int
+	progress  func(done, total int)
+}
+
+// WithChunkSize sets the number of downloads added per system.multicall,
+// DefaultChunkSize by default.
+func WithChunkSize(n int) ImportOption {
+	return func(c *importConfig) { c.chunkSize = n }
+}
+
+// WithProgress sets a function called after each chunk with the number of
+// entries imported so far.
+func WithProgress(fn func(done, total int)) ImportOption {
+	return func(c *importConfig) { c.progress = fn }
+}
+
+// Import adds entries to aria2 with aria2.addUri, in chunks sent through
+// system.multicall. It returns the result of each entry, in order: an entry
+// rejected by aria2 or with invalid options does not stop the import.
+//
+// The error is only about a chunk as a whole, e.g. when the connection is
+// lost. Import then stops, and the results only cover the entries up to the
+// failed chunk, whose results hold the error.
+func Import(ctx context.Context, c *ario.Client, entries []Entry, opts ...ImportOption) ([]Result, error) {
+	cfg := &importConfig{chunkSize: DefaultChunkSize}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.chunkSize <= 0 {
+		cfg.chunkSize = DefaultChunkSize
+	}
+
+	results := make([]Result, 0, len(entries))
+	for start := 0; start < len(entries); start += cfg.chunkSize {
+		end := min(start+cfg.chunkSize, len(entries))
+
+		b := c.NewBatch()
+		gids := make([]*ario.Future[string], 0, end-start)
+		for i := start; i < end; i++ {
+			gids = append(gids, b.AddURI(entries[i].URIs, &entries[i].Options))
+		}
+
+		err := b.RunContext(ctx)
+		for i, f := range gids {
+			gid, err := f.Get()
+			results = append(results, Result{Entry: start + i, GID: gid, Err: err})
+		}
+		if err != nil {
+			return results, err
+		}
+
+		if cfg.progress != nil {
+			cfg.progress(end, len(entries))
+		}
+	}
+	return results, nil
+}
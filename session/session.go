@@ -0,0 +1,146 @@
+// Package session reads and writes the files of aria2's --input-file and
+// --save-session options, and imports them into a running aria2.
+//
+// Each download is a line with its URIs separated by tabs, which are mirrors
+// of the same file, followed by its options on indented name=value lines:
+//
+//	https://a.example.com/file.iso	https://b.example.com/file.iso
+//	  dir=/downloads
+//	  out=file.iso
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	ario "github.com/kahosan/aria2-rpc"
+	"github.com/kahosan/aria2-rpc/internal/optfile"
+)
+
+// Entry is a download of a session file.
+type Entry struct {
+	URIs    []string
+	Options ario.Options
+}
+
+// ParseError reports an invalid line of a session file.
+type ParseError struct {
+	Line int // 1-based
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Parse reads the downloads of a session file. The options are checked like
+// the options sent to aria2, an invalid one is reported as a *ParseError that
+// wraps the *ario.OptionError.
+func Parse(r io.Reader) ([]Entry, error) {
+	var (
+		entries []Entry
+		values  map[string][]string
+	)
+
+	// flush sets the options of the last entry
+	flush := func() error {
+		if len(entries) == 0 || len(values) == 0 {
+			return nil
+		}
+		return optfile.Decode(values, &entries[len(entries)-1].Options)
+	}
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		raw := s.Text()
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if raw[0] != ' ' && raw[0] != '\t' {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			entries = append(entries, Entry{URIs: strings.Split(line, "\t")})
+			values = make(map[string][]string)
+			continue
+		}
+
+		if len(entries) == 0 {
+			return nil, &ParseError{Line: n, Err: fmt.Errorf("option %q before any URI", line)}
+		}
+
+		name, value, err := optfile.Cut(line)
+		if err != nil {
+			return nil, &ParseError{Line: n, Err: err}
+		}
+		if err := check(name, value); err != nil {
+			return nil, &ParseError{Line: n, Err: err}
+		}
+		optfile.Add(values, name, value)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ParseFile reads the downloads of the session file name.
+func ParseFile(name string) ([]Entry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return entries, nil
+}
+
+// Write writes entries in the format of aria2's --save-session, with the
+// options of each entry sorted by name.
+func Write(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	for i, e := range entries {
+		if len(e.URIs) == 0 {
+			return fmt.Errorf("entry %d has no URI", i)
+		}
+
+		values, err := optfile.Encode(&e.Options)
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", i, err)
+		}
+
+		fmt.Fprintln(bw, strings.Join(e.URIs, "\t"))
+		for _, name := range optfile.Names(values) {
+			for _, value := range values[name] {
+				fmt.Fprintf(bw, " %s=%s\n", name, value)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// check reports whether value is valid for the option name.
+func check(name, value string) error {
+	var o ario.Options
+	if err := optfile.Decode(map[string][]string{name: {value}}, &o); err != nil {
+		return err
+	}
+	return o.Validate()
+}
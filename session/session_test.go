@@ -0,0 +1,162 @@
+package session_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	ario "github.com/kahosan/aria2-rpc"
+	"github.com/kahosan/aria2-rpc/ariotest"
+	"github.com/kahosan/aria2-rpc/resp"
+	"github.com/kahosan/aria2-rpc/session"
+)
+
+const sample = `# saved by aria2
+https://a.example.com/file.iso	https://b.example.com/file.iso
+ dir=/downloads
+ gid=2089b05ecca3d829
+ header=X-A: 1
+ header=X-B: 2
+ pause=true
+
+https://example.com/other.zip
+	out=other.zip
+`
+
+func TestSession(t *testing.T) {
+
+	t.Run("parse", func(t *testing.T) {
+		entries, err := session.Parse(strings.NewReader(sample))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 {
+			t.Fatal("unexpected number of entries", len(entries))
+		}
+
+		e := entries[0]
+		if !reflect.DeepEqual(e.URIs, []string{"https://a.example.com/file.iso", "https://b.example.com/file.iso"}) {
+			t.Fatal("unexpected uris", e.URIs)
+		}
+		if *e.Options.Dir != "/downloads" || *e.Options.GID != "2089b05ecca3d829" || !*e.Options.Pause {
+			t.Fatal("unexpected options", e.Options)
+		}
+		if !reflect.DeepEqual(e.Options.Header, []string{"X-A: 1", "X-B: 2"}) {
+			t.Fatal("unexpected header", e.Options.Header)
+		}
+
+		if *entries[1].Options.Out != "other.zip" || entries[1].Options.Dir != nil {
+			t.Fatal("options of the entries are mixed up", entries[1].Options)
+		}
+	})
+
+	t.Run("parse errors", func(t *testing.T) {
+		var pe *session.ParseError
+
+		_, err := session.Parse(strings.NewReader(" dir=/tmp\nhttps://example.com\n"))
+		if !errors.As(err, &pe) || pe.Line != 1 {
+			t.Fatal("expected a parse error on line 1, got", err)
+		}
+
+		_, err = session.Parse(strings.NewReader("https://example.com\n split=0\n"))
+		if !errors.As(err, &pe) || pe.Line != 2 || !errors.Is(err, ario.ErrInvalidOption) {
+			t.Fatal("expected an invalid option on line 2, got", err)
+		}
+		t.Log(err)
+	})
+
+	t.Run("write", func(t *testing.T) {
+		entries, err := session.Parse(strings.NewReader(sample))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := session.Write(&buf, entries); err != nil {
+			t.Fatal(err)
+		}
+
+		want := "https://a.example.com/file.iso\thttps://b.example.com/file.iso\n" +
+			" dir=/downloads\n gid=2089b05ecca3d829\n header=X-A: 1\n header=X-B: 2\n pause=true\n" +
+			"https://example.com/other.zip\n out=other.zip\n"
+		if buf.String() != want {
+			t.Fatalf("unexpected output:\n%s", buf.String())
+		}
+
+		again, err := session.Parse(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(entries, again) {
+			t.Fatal("round trip changed the entries")
+		}
+
+		if err := session.Write(&buf, []session.Entry{{}}); err == nil {
+			t.Fatal("expected an error for an entry without URI")
+		}
+	})
+
+	t.Run("import", func(t *testing.T) {
+		srv := ariotest.NewServer(ariotest.WithSecret("secret"))
+		defer srv.Close()
+
+		client, err := ario.NewClient(srv.URL, "secret", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		var entries []session.Entry
+		for i := range 5 {
+			entries = append(entries, session.Entry{URIs: []string{fmt.Sprintf("https://example.com/%d", i)}})
+		}
+		entries[1].Options.GID = ario.Ptr("2089b05ecca3d829")
+		entries[1].Options.Pause = ario.Ptr(true)
+		entries[2].Options.GID = ario.Ptr("invalid")
+		entries[3].Options.Split = ario.Ptr(0)
+
+		var progress []int
+		results, err := session.Import(context.Background(), client, entries,
+			session.WithChunkSize(2),
+			session.WithProgress(func(done, total int) {
+				if total != len(entries) {
+					t.Error("unexpected total", total)
+				}
+				progress = append(progress, done)
+			}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(progress, []int{2, 4, 5}) {
+			t.Fatal("unexpected progress", progress)
+		}
+		if len(results) != len(entries) {
+			t.Fatal("unexpected number of results", len(results))
+		}
+		for i, r := range results {
+			if r.Entry != i {
+				t.Fatal("results out of order", results)
+			}
+			if failed := i == 2 || i == 3; failed != (r.Err != nil) {
+				t.Fatalf("unexpected result of entry %d: %+v", i, r)
+			}
+		}
+		if !errors.Is(results[3].Err, ario.ErrInvalidOption) {
+			t.Fatal("expected an invalid option, got", results[3].Err)
+		}
+
+		status, err := client.TellStatus("2089b05ecca3d829")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Status != resp.StatusPaused {
+			t.Fatal("the options of the entry were not sent", status.Status)
+		}
+	})
+}
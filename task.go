@@ -0,0 +1,358 @@
+package ario
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kahosan/aria2-rpc/notifier"
+	"github.com/kahosan/aria2-rpc/resp"
+)
+
+// ErrDownloadRemoved is returned by Task.Wait for a download that was removed
+// before it finished.
+var ErrDownloadRemoved = errors.New("download removed")
+
+// DefaultTaskInterval is the default polling and progress period of a Task.
+const DefaultTaskInterval = time.Second
+
+// Task is a logical download: the downloads returned when it was added, and
+// the ones they are followed by, such as the download of the content of a
+// magnet link once its metadata is fetched.
+//
+// A Task is woken up by the notifications of aria2 if the client was created
+// with WithNotify, through a listener shared by the tasks of the client and
+// closed by Client.Close. It polls the status of its downloads every Interval
+// otherwise. Downloads that are not active are also polled every 10 Interval
+// with notifications, in case one is missed.
+type Task struct {
+	// Interval is the polling period, and the period of the Progress
+	// snapshots while a download is active. It must be set before the task is
+	// used.
+	Interval time.Duration
+
+	c *Client
+
+	mu   sync.Mutex
+	gids []string // the downloads followed, the leaves of the tree of followedBy
+}
+
+// Progress is a snapshot of the downloads of a Task.
+type Progress struct {
+	Statuses        []resp.Status // status of each download currently followed
+	TotalLength     int64
+	CompletedLength int64
+	DownloadSpeed   resp.Speed
+	UploadSpeed     resp.Speed
+	Done            bool  // whether every download ended
+	Err             error // the failed call that ended the snapshots, if any
+}
+
+// Task returns the Task of existing downloads.
+func (c *Client) Task(gids ...string) *Task {
+	return &Task{Interval: DefaultTaskInterval, c: c, gids: slices.Clone(gids)}
+}
+
+func (c *Client) AddURITask(uris []string, options *Options) (*Task, error) {
+	return c.AddURITaskContext(context.Background(), uris, options)
+}
+
+// AddURITaskContext adds a download with aria2.addUri and returns its Task.
+func (c *Client) AddURITaskContext(ctx context.Context, uris []string, options *Options) (*Task, error) {
+	gid, err := c.AddURIContext(ctx, uris, options)
+	if err != nil {
+		return nil, err
+	}
+	return c.Task(gid), nil
+}
+
+func (c *Client) AddTorrentTask(torrent *[]byte, uris *[]string, options *Options) (*Task, error) {
+	return c.AddTorrentTaskContext(context.Background(), torrent, uris, options)
+}
+
+// AddTorrentTaskContext adds a download with aria2.addTorrent and returns its
+// Task.
+func (c *Client) AddTorrentTaskContext(ctx context.Context, torrent *[]byte, uris *[]string, options *Options) (*Task, error) {
+	gid, err := c.AddTorrentContext(ctx, torrent, uris, options)
+	if err != nil {
+		return nil, err
+	}
+	return c.Task(gid), nil
+}
+
+func (c *Client) AddMetalinkTask(metalink *[]byte, options *Options) (*Task, error) {
+	return c.AddMetalinkTaskContext(context.Background(), metalink, options)
+}
+
+// AddMetalinkTaskContext adds the downloads of a Metalink with
+// aria2.addMetalink and returns a Task that follows all of them.
+func (c *Client) AddMetalinkTaskContext(ctx context.Context, metalink *[]byte, options *Options) (*Task, error) {
+	gids, err := c.AddMetalinkContext(ctx, metalink, options)
+	if err != nil {
+		return nil, err
+	}
+	return c.Task(gids...), nil
+}
+
+// GIDs returns the downloads currently followed by the task.
+func (t *Task) GIDs() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Clone(t.gids)
+}
+
+// Wait waits until every download of the task ended, following the downloads
+// they are followed by. It returns the final status of the first download.
+//
+// A download that failed is reported as a *DownloadError, one that was
+// removed as ErrDownloadRemoved. A BitTorrent download ends once it is
+// complete, even if it keeps seeding.
+func (t *Task) Wait(ctx context.Context) (resp.Status, error) {
+	w := t.watch(ctx)
+	defer w.stop()
+
+	for {
+		p, err := t.poll(ctx)
+		if err != nil {
+			return resp.Status{}, err
+		}
+		if p.Done {
+			return p.Statuses[0], taskError(p.Statuses)
+		}
+
+		if w.follow(t.GIDs()) {
+			continue
+		}
+		if err := t.sleep(ctx, w.wake, false); err != nil {
+			return resp.Status{}, err
+		}
+	}
+}
+
+// Progress returns a channel that receives a snapshot of the downloads every
+// Interval while one is active, and as soon as one changes state if
+// notifications are enabled. The last snapshot has Done set, the channel is
+// then closed. On the first failed call, a last snapshot with only Err set is
+// sent. The channel is also closed when ctx ends.
+func (t *Task) Progress(ctx context.Context) <-chan Progress {
+	ch := make(chan Progress)
+
+	go func() {
+		defer close(ch)
+
+		w := t.watch(ctx)
+		defer w.stop()
+
+		for {
+			p, err := t.poll(ctx)
+			if err != nil {
+				p = Progress{Err: err}
+			}
+
+			select {
+			case ch <- p:
+			case <-ctx.Done():
+				return
+			}
+			if p.Done || p.Err != nil {
+				return
+			}
+
+			if w.follow(t.GIDs()) {
+				continue
+			}
+			// bytes are not notified, tick while a download is active
+			if err := t.sleep(ctx, w.wake, active(p.Statuses)); err != nil {
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// Pause pauses the active and waiting downloads of the task that did not
+// end.
+func (t *Task) Pause(ctx context.Context) error {
+	return t.each(ctx, t.c.PauseContext, func(s resp.Status) bool {
+		return s.Status == resp.StatusActive || s.Status == resp.StatusWaiting
+	})
+}
+
+// Resume resumes the paused downloads of the task.
+func (t *Task) Resume(ctx context.Context) error {
+	return t.each(ctx, t.c.UnpauseContext, func(s resp.Status) bool {
+		return s.Status == resp.StatusPaused
+	})
+}
+
+// Cancel removes the downloads of the task that did not end.
+func (t *Task) Cancel(ctx context.Context) error {
+	return t.each(ctx, t.c.RemoveContext, func(resp.Status) bool { return true })
+}
+
+// each calls fn for the downloads that did not end and match, aria2 rejects
+// the calls for the downloads in another state.
+func (t *Task) each(ctx context.Context, fn func(ctx context.Context, gid string) error, match func(s resp.Status) bool) error {
+	p, err := t.poll(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, s := range p.Statuses {
+		if ended(s) || !match(s) {
+			continue
+		}
+		if err := fn(ctx, s.Gid); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t *Task) interval() time.Duration {
+	if t.Interval <= 0 {
+		return DefaultTaskInterval
+	}
+	return t.Interval
+}
+
+// poll fetches the status of the downloads of the task, and replaces the
+// completed ones that are followed by other downloads with the latter.
+func (t *Task) poll(ctx context.Context) (Progress, error) {
+	gids := t.GIDs()
+	if len(gids) == 0 {
+		return Progress{}, errors.New("task has no download")
+	}
+
+	var p Progress
+	for i := 0; i < len(gids); i++ {
+		s, err := t.c.TellStatusContext(ctx, gids[i])
+		if errors.Is(err, ErrGIDNotFound) {
+			// removed, and purged from the results
+			s, err = resp.Status{Gid: gids[i], Status: resp.StatusRemoved}, nil
+		}
+		if err != nil {
+			return Progress{}, err
+		}
+
+		if s.Status == resp.StatusComplete && len(s.FollowedBy) > 0 {
+			gids = slices.Replace(gids, i, i+1, s.FollowedBy...)
+			i--
+			continue
+		}
+
+		p.Statuses = append(p.Statuses, s)
+		p.TotalLength += s.TotalLength
+		p.CompletedLength += s.CompletedLength
+		p.DownloadSpeed += s.DownloadSpeed
+		p.UploadSpeed += s.UploadSpeed
+	}
+
+	t.mu.Lock()
+	t.gids = gids
+	t.mu.Unlock()
+
+	p.Done = !slices.ContainsFunc(p.Statuses, func(s resp.Status) bool { return !ended(s) })
+	return p, nil
+}
+
+// watcher wakes a task up when aria2 notifies a change of one of its
+// downloads, through the listener shared by the tasks of the client.
+type watcher struct {
+	ctx  context.Context
+	n    *notifier.Notify
+	wake chan struct{} // nil if notifications are disabled
+	gids []string
+	sub  *notifier.Subscription
+}
+
+// watch returns the watcher of the downloads currently followed.
+func (t *Task) watch(ctx context.Context) *watcher {
+	n := t.c.listener()
+	if n == nil {
+		return &watcher{}
+	}
+
+	w := &watcher{ctx: ctx, n: n, wake: make(chan struct{}, 1)}
+	w.follow(t.GIDs())
+	return w
+}
+
+// follow subscribes to the events of gids instead of the previous ones. It
+// reports whether they changed, an event may then have been missed.
+func (w *watcher) follow(gids []string) bool {
+	if w.n == nil || slices.Equal(gids, w.gids) {
+		return false
+	}
+
+	w.stop()
+	w.gids = gids
+	w.sub = w.n.Handle(w.ctx, func(notifier.Event) {
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	}, notifier.WithGIDs(gids...))
+	return true
+}
+
+func (w *watcher) stop() {
+	if w.sub != nil {
+		w.sub.Unsubscribe()
+	}
+}
+
+// sleep waits for a notification, or the polling period. The period is
+// longer when notifications are enabled, they are only missed on overflow,
+// unless tick is set.
+func (t *Task) sleep(ctx context.Context, wake <-chan struct{}, tick bool) error {
+	d := t.interval()
+	if wake != nil && !tick {
+		d *= 10
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-wake:
+	case <-timer.C:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// ended reports whether a download ended, a seeding BitTorrent download did.
+func ended(s resp.Status) bool {
+	return s.Status.Stopped() || (s.Status == resp.StatusActive && s.Seeder)
+}
+
+// active reports whether a download is active and did not end.
+func active(statuses []resp.Status) bool {
+	return slices.ContainsFunc(statuses, func(s resp.Status) bool {
+		return s.Status == resp.StatusActive && !ended(s)
+	})
+}
+
+// taskError returns the error of the first download that failed or was
+// removed.
+func taskError(statuses []resp.Status) error {
+	for _, s := range statuses {
+		switch s.Status {
+		case resp.StatusError:
+			if err := StatusError(s); err != nil {
+				return err
+			}
+			return &DownloadError{Gid: s.Gid, Message: s.ErrorMessage}
+		case resp.StatusRemoved:
+			return fmt.Errorf("download %s: %w", s.Gid, ErrDownloadRemoved)
+		}
+	}
+	return nil
+}
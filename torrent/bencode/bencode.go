@@ -0,0 +1,238 @@
+// Package bencode decodes and encodes the bencoding of BitTorrent files.
+//
+// Values are decoded into plain Go types: dictionaries into map[string]any,
+// lists into []any, integers into int64 and byte strings into string.
+package bencode
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// maxDepth bounds the nesting of lists and dictionaries.
+const maxDepth = 512
+
+// RawMessage is a bencoded value, kept as is.
+type RawMessage []byte
+
+// SyntaxError reports malformed bencoding.
+type SyntaxError struct {
+	Offset int // offset in the input where the error occurred
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("bencode: %s at offset %d", e.Msg, e.Offset)
+}
+
+// Decode parses data, which must hold exactly one bencoded value.
+func Decode(data []byte) (any, error) {
+	d := &decoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.off != len(data) {
+		return nil, d.errorf("trailing data")
+	}
+	return v, nil
+}
+
+// DecodeDict parses data, which must hold a dictionary, and returns the raw
+// value of each of its keys. It is used to compute a hash over the exact bytes
+// of a value, such as the info dictionary of a torrent.
+func DecodeDict(data []byte) (map[string]RawMessage, error) {
+	d := &decoder{data: data}
+	if d.off >= len(data) || data[d.off] != 'd' {
+		return nil, d.errorf("expected a dictionary")
+	}
+	d.off++
+
+	dict := make(map[string]RawMessage)
+	for {
+		if d.off >= len(data) {
+			return nil, d.errorf("unexpected end of data")
+		}
+		if data[d.off] == 'e' {
+			d.off++
+			break
+		}
+
+		key, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		start := d.off
+		if _, err := d.value(1); err != nil {
+			return nil, err
+		}
+		dict[key] = RawMessage(data[start:d.off])
+	}
+
+	if d.off != len(data) {
+		return nil, d.errorf("trailing data")
+	}
+	return dict, nil
+}
+
+type decoder struct {
+	data []byte
+	off  int
+}
+
+func (d *decoder) errorf(format string, args ...any) error {
+	return &SyntaxError{Offset: d.off, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (d *decoder) value(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, d.errorf("nested too deeply")
+	}
+	if d.off >= len(d.data) {
+		return nil, d.errorf("unexpected end of data")
+	}
+
+	switch c := d.data[d.off]; {
+	case c == 'i':
+		return d.int()
+	case c >= '0' && c <= '9':
+		return d.string()
+	case c == 'l':
+		d.off++
+		list := []any{}
+		for {
+			if d.off >= len(d.data) {
+				return nil, d.errorf("unexpected end of data")
+			}
+			if d.data[d.off] == 'e' {
+				d.off++
+				return list, nil
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+	case c == 'd':
+		d.off++
+		dict := make(map[string]any)
+		for {
+			if d.off >= len(d.data) {
+				return nil, d.errorf("unexpected end of data")
+			}
+			if d.data[d.off] == 'e' {
+				d.off++
+				return dict, nil
+			}
+			key, err := d.string()
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			dict[key] = v
+		}
+	default:
+		return nil, d.errorf("unexpected byte %q", c)
+	}
+}
+
+func (d *decoder) int() (int64, error) {
+	end := bytes.IndexByte(d.data[d.off:], 'e')
+	if end < 0 {
+		return 0, d.errorf("unterminated integer")
+	}
+
+	s := string(d.data[d.off+1 : d.off+end])
+	if s == "-0" || (len(s) > 1 && s[0] == '0') || (len(s) > 2 && s[:2] == "-0") {
+		return 0, d.errorf("invalid integer %q", s)
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, d.errorf("invalid integer %q", s)
+	}
+
+	d.off += end + 1
+	return n, nil
+}
+
+func (d *decoder) string() (string, error) {
+	colon := bytes.IndexByte(d.data[d.off:], ':')
+	if colon < 0 {
+		return "", d.errorf("expected a string")
+	}
+
+	n, err := strconv.Atoi(string(d.data[d.off : d.off+colon]))
+	if err != nil || n < 0 {
+		return "", d.errorf("invalid string length %q", d.data[d.off:d.off+colon])
+	}
+
+	start := d.off + colon + 1
+	if n > len(d.data)-start {
+		return "", d.errorf("string overflows the data")
+	}
+
+	d.off = start + n
+	return string(d.data[start:d.off]), nil
+}
+
+// Encode returns the bencoding of v, which can be made of map[string]any,
+// []any, string, []byte, RawMessage, and integers. The keys of dictionaries
+// are sorted, as the bencoding requires.
+func Encode(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encode(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case RawMessage:
+		buf.Write(v)
+	case string:
+		buf.WriteString(strconv.Itoa(len(v)))
+		buf.WriteByte(':')
+		buf.WriteString(v)
+	case []byte:
+		buf.WriteString(strconv.Itoa(len(v)))
+		buf.WriteByte(':')
+		buf.Write(v)
+	case int:
+		fmt.Fprintf(buf, "i%de", v)
+	case int64:
+		fmt.Fprintf(buf, "i%de", v)
+	case []any:
+		buf.WriteByte('l')
+		for _, e := range v {
+			if err := encode(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('e')
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+
+		buf.WriteByte('d')
+		for _, k := range keys {
+			encode(buf, k)
+			if err := encode(buf, v[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('e')
+	default:
+		return fmt.Errorf("bencode: unsupported type %T", v)
+	}
+	return nil
+}
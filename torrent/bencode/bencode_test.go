@@ -0,0 +1,64 @@
+package bencode_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kahosan/aria2-rpc/torrent/bencode"
+)
+
+func TestBencode(t *testing.T) {
+
+	t.Run("decode", func(t *testing.T) {
+		v, err := bencode.Decode([]byte("d4:listli1ei-2e3:abce3:num0:4:spam4:eggse"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string]any{
+			"list": []any{int64(1), int64(-2), "abc"},
+			"num":  "",
+			"spam": "eggs",
+		}
+		if !reflect.DeepEqual(v, want) {
+			t.Fatalf("unexpected value %#v", v)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, s := range []string{"", "i03e", "i-0e", "i1", "5:abc", "l", "d3:keye", "di1ei2ee", "x", "i1ei2e", strings.Repeat("l", 1000)} {
+			_, err := bencode.Decode([]byte(s))
+			var se *bencode.SyntaxError
+			if !errors.As(err, &se) {
+				t.Fatalf("%q: expected a syntax error, got %v", s, err)
+			}
+		}
+	})
+
+	t.Run("raw dict", func(t *testing.T) {
+		dict, err := bencode.DecodeDict([]byte("d1:ai1e4:infod4:name1:xee"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(dict["info"]) != "d4:name1:xe" || string(dict["a"]) != "i1e" {
+			t.Fatalf("unexpected raw values %q", dict)
+		}
+	})
+
+	t.Run("encode", func(t *testing.T) {
+		v := map[string]any{"b": []any{1, "x"}, "a": []byte("yz"), "c": bencode.RawMessage("i7e")}
+		data, err := bencode.Encode(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "d1:a2:yz1:bli1e1:xe1:ci7ee" {
+			t.Fatalf("unexpected encoding %q", data)
+		}
+
+		if _, err := bencode.Encode(1.5); err == nil {
+			t.Fatal("expected an error for a float")
+		}
+	})
+}
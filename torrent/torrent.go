@@ -0,0 +1,308 @@
+// Package torrent reads BitTorrent metainfo (.torrent) files, to inspect them
+// before they are given to aria2.addTorrent.
+//
+// Both v1 and v2 (BEP 52) torrents are supported, as well as hybrid ones.
+package torrent
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kahosan/aria2-rpc/torrent/bencode"
+)
+
+// ErrInvalidTorrent is returned, wrapped, for a file that is not valid
+// metainfo.
+var ErrInvalidTorrent = errors.New("invalid torrent")
+
+// Torrent is the content of a .torrent file.
+type Torrent struct {
+	InfoHash     [20]byte // SHA-1 of the info dictionary, zero for a v2 only torrent
+	InfoHashV2   [32]byte // SHA-256 of the info dictionary, zero for a v1 only torrent
+	Name         string
+	Files        []File
+	PieceLength  int64
+	Private      bool
+	Trackers     [][]string // announce URLs by tier
+	WebSeeds     []string   // HTTP or FTP seeds, BEP 19
+	Comment      string
+	CreatedBy    string
+	CreationDate time.Time // zero if unknown
+}
+
+// File is a file of a torrent.
+type File struct {
+	// Index of the file, starting at 1, as used by the select-file option and
+	// returned by aria2.getFiles. Padding files are counted too.
+	Index   int
+	Path    string // relative path, with / separators, starting with the name of the torrent for multi-file torrents
+	Length  int64
+	Padding bool // padding file inserted for piece alignment, BEP 47
+}
+
+// Parse reads the metainfo in data.
+func Parse(data []byte) (*Torrent, error) {
+	root, err := bencode.DecodeDict(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidTorrent, err)
+	}
+
+	rawInfo, ok := root["info"]
+	if !ok {
+		return nil, fmt.Errorf("%w: no info dictionary", ErrInvalidTorrent)
+	}
+	// the raw info is kept for the hashes, the values are decoded from the
+	// whole document again
+	v, err := bencode.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidTorrent, err)
+	}
+	rest := v.(map[string]any)
+	info, ok := rest["info"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: info is not a dictionary", ErrInvalidTorrent)
+	}
+
+	t := &Torrent{
+		Name:        str(info["name"]),
+		PieceLength: integer(info["piece length"]),
+		Private:     integer(info["private"]) == 1,
+	}
+	if t.Name == "" {
+		return nil, fmt.Errorf("%w: no name", ErrInvalidTorrent)
+	}
+	if t.PieceLength <= 0 {
+		return nil, fmt.Errorf("%w: invalid piece length %d", ErrInvalidTorrent, t.PieceLength)
+	}
+
+	v1 := info["pieces"] != nil
+	v2 := integer(info["meta version"]) == 2
+	switch {
+	case v1:
+		t.InfoHash = sha1.Sum(rawInfo)
+		if t.Files, err = filesV1(t.Name, info); err != nil {
+			return nil, err
+		}
+	case v2:
+		if t.Files, err = filesV2(t.Name, info); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: neither pieces nor a v2 file tree", ErrInvalidTorrent)
+	}
+	if v2 {
+		t.InfoHashV2 = sha256.Sum256(rawInfo)
+	}
+
+	t.Trackers = trackers(rest)
+	t.WebSeeds = strs(rest["url-list"])
+	t.Comment = str(rest["comment"])
+	t.CreatedBy = str(rest["created by"])
+	if d := integer(rest["creation date"]); d > 0 {
+		t.CreationDate = time.Unix(d, 0)
+	}
+
+	return t, nil
+}
+
+// ParseFile reads the .torrent file name.
+func ParseFile(name string) (*Torrent, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return t, nil
+}
+
+// InfoHashHex returns the v1 info hash in hex, as aria2 reports it in the
+// infoHash key of aria2.tellStatus, or the v2 one for a v2 only torrent.
+func (t *Torrent) InfoHashHex() string {
+	if t.InfoHash == [20]byte{} {
+		return hex.EncodeToString(t.InfoHashV2[:])
+	}
+	return hex.EncodeToString(t.InfoHash[:])
+}
+
+// TotalLength returns the size of the files, padding excluded.
+func (t *Torrent) TotalLength() int64 {
+	var n int64
+	for _, f := range t.Files {
+		if !f.Padding {
+			n += f.Length
+		}
+	}
+	return n
+}
+
+// SelectFile returns the value of the select-file option that downloads the
+// files for which keep returns true, e.g. "1,3-5". Padding files are never
+// selected. It returns "" if no file is kept.
+func (t *Torrent) SelectFile(keep func(f File) bool) string {
+	var ranges []string
+	start, end := 0, 0
+
+	flush := func() {
+		switch {
+		case start == 0:
+		case start == end:
+			ranges = append(ranges, strconv.Itoa(start))
+		default:
+			ranges = append(ranges, strconv.Itoa(start)+"-"+strconv.Itoa(end))
+		}
+		start = 0
+	}
+
+	for _, f := range t.Files {
+		if f.Padding || !keep(f) {
+			continue
+		}
+		if start != 0 && f.Index == end+1 {
+			end = f.Index
+			continue
+		}
+		flush()
+		start, end = f.Index, f.Index
+	}
+	flush()
+
+	return strings.Join(ranges, ",")
+}
+
+func filesV1(name string, info map[string]any) ([]File, error) {
+	list, multi := info["files"].([]any)
+	if !multi {
+		// aria2 rejects a single-file torrent without a length
+		length, ok := info["length"].(int64)
+		if !ok {
+			return nil, fmt.Errorf("%w: neither length nor files", ErrInvalidTorrent)
+		}
+		if length < 0 {
+			return nil, fmt.Errorf("%w: invalid length %d", ErrInvalidTorrent, length)
+		}
+		return []File{{Index: 1, Path: name, Length: length}}, nil
+	}
+
+	files := make([]File, 0, len(list))
+	for i, v := range list {
+		f, _ := v.(map[string]any)
+		parts := strs(f["path"])
+		length := integer(f["length"])
+		if len(parts) == 0 || length < 0 {
+			return nil, fmt.Errorf("%w: invalid file %d", ErrInvalidTorrent, i+1)
+		}
+
+		files = append(files, File{
+			Index:   i + 1,
+			Path:    name + "/" + strings.Join(parts, "/"),
+			Length:  length,
+			Padding: strings.Contains(str(f["attr"]), "p"),
+		})
+	}
+	return files, nil
+}
+
+// filesV2 walks the file tree of a v2 torrent, in the order of its keys.
+func filesV2(name string, info map[string]any) ([]File, error) {
+	tree, ok := info["file tree"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: no file tree", ErrInvalidTorrent)
+	}
+
+	var files []File
+	var walk func(dir []string, node map[string]any) error
+	walk = func(dir []string, node map[string]any) error {
+		keys := make([]string, 0, len(node))
+		for k := range node {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+
+		for _, k := range keys {
+			child, ok := node[k].(map[string]any)
+			if !ok {
+				return fmt.Errorf("%w: invalid file tree", ErrInvalidTorrent)
+			}
+			if leaf, ok := child[""].(map[string]any); ok {
+				files = append(files, File{
+					Index:  len(files) + 1,
+					Path:   strings.Join(append(dir, k), "/"),
+					Length: integer(leaf["length"]),
+				})
+				continue
+			}
+			if err := walk(append(dir, k), child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(nil, tree); err != nil {
+		return nil, err
+	}
+
+	// a single file torrent has the name of the torrent as its only entry
+	if len(files) == 1 && files[0].Path == name {
+		return files, nil
+	}
+	for i := range files {
+		files[i].Path = name + "/" + files[i].Path
+	}
+	return files, nil
+}
+
+func trackers(root map[string]any) [][]string {
+	var tiers [][]string
+	if list, ok := root["announce-list"].([]any); ok {
+		for _, tier := range list {
+			if urls := strs(tier); len(urls) > 0 {
+				tiers = append(tiers, urls)
+			}
+		}
+	}
+	if len(tiers) == 0 {
+		if url := str(root["announce"]); url != "" {
+			tiers = [][]string{{url}}
+		}
+	}
+	return tiers
+}
+
+func str(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func integer(v any) int64 {
+	n, _ := v.(int64)
+	return n
+}
+
+// strs returns the strings of a list, or a single string as a list.
+func strs(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var list []string
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
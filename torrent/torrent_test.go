@@ -0,0 +1,170 @@
+package torrent_test
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kahosan/aria2-rpc/torrent"
+	"github.com/kahosan/aria2-rpc/torrent/bencode"
+)
+
+func encode(t *testing.T, v map[string]any) []byte {
+	t.Helper()
+	data, err := bencode.Encode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestTorrent(t *testing.T) {
+
+	t.Run("multi file", func(t *testing.T) {
+		info := map[string]any{
+			"name":         "album",
+			"piece length": 16384,
+			"pieces":       strings.Repeat("x", 20),
+			"files": []any{
+				map[string]any{"length": 100, "path": []any{"cd1", "01.flac"}},
+				map[string]any{"length": 16284, "path": []any{".pad", "16284"}, "attr": "p"},
+				map[string]any{"length": 200, "path": []any{"cd1", "02.flac"}},
+				map[string]any{"length": 10, "path": []any{"cover.jpg"}},
+			},
+		}
+		data := encode(t, map[string]any{
+			"announce":      "http://a.example.com/announce",
+			"announce-list": []any{[]any{"http://a.example.com/announce", "http://b.example.com/announce"}, []any{"udp://c.example.com:80"}},
+			"url-list":      "http://seed.example.com/",
+			"comment":       "test",
+			"creation date": 1672531200,
+			"info":          info,
+		})
+
+		tr, err := torrent.Parse(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tr.InfoHash != sha1.Sum(encode(t, info)) || tr.InfoHashV2 != [32]byte{} {
+			t.Fatal("unexpected info hash", tr.InfoHashHex())
+		}
+		if tr.Name != "album" || tr.PieceLength != 16384 || tr.Comment != "test" || !tr.CreationDate.Equal(time.Unix(1672531200, 0)) {
+			t.Fatalf("unexpected torrent %+v", tr)
+		}
+		if len(tr.Trackers) != 2 || len(tr.Trackers[0]) != 2 || tr.Trackers[1][0] != "udp://c.example.com:80" {
+			t.Fatal("unexpected trackers", tr.Trackers)
+		}
+		if !reflect.DeepEqual(tr.WebSeeds, []string{"http://seed.example.com/"}) {
+			t.Fatal("unexpected web seeds", tr.WebSeeds)
+		}
+
+		want := []torrent.File{
+			{Index: 1, Path: "album/cd1/01.flac", Length: 100},
+			{Index: 2, Path: "album/.pad/16284", Length: 16284, Padding: true},
+			{Index: 3, Path: "album/cd1/02.flac", Length: 200},
+			{Index: 4, Path: "album/cover.jpg", Length: 10},
+		}
+		if !reflect.DeepEqual(tr.Files, want) {
+			t.Fatalf("unexpected files %+v", tr.Files)
+		}
+		if tr.TotalLength() != 310 {
+			t.Fatal("unexpected total length", tr.TotalLength())
+		}
+
+		flac := tr.SelectFile(func(f torrent.File) bool { return strings.HasSuffix(f.Path, ".flac") })
+		all := tr.SelectFile(func(torrent.File) bool { return true })
+		if flac != "1,3" || all != "1,3-4" {
+			t.Fatal("unexpected select-file", flac, all)
+		}
+	})
+
+	t.Run("single file", func(t *testing.T) {
+		tr, err := torrent.Parse(encode(t, map[string]any{
+			"announce": "http://a.example.com/announce",
+			"info":     map[string]any{"name": "file.iso", "piece length": 262144, "pieces": strings.Repeat("x", 20), "length": 1 << 20, "private": 1},
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(tr.Files, []torrent.File{{Index: 1, Path: "file.iso", Length: 1 << 20}}) || !tr.Private {
+			t.Fatalf("unexpected torrent %+v", tr)
+		}
+		if !reflect.DeepEqual(tr.Trackers, [][]string{{"http://a.example.com/announce"}}) {
+			t.Fatal("unexpected trackers", tr.Trackers)
+		}
+		if len(tr.InfoHashHex()) != 40 {
+			t.Fatal("unexpected info hash", tr.InfoHashHex())
+		}
+	})
+
+	t.Run("hybrid", func(t *testing.T) {
+		info := map[string]any{
+			"name":         "dir",
+			"piece length": 16384,
+			"pieces":       strings.Repeat("x", 20),
+			"meta version": 2,
+			"files":        []any{map[string]any{"length": 5, "path": []any{"a.txt"}}},
+			"file tree": map[string]any{
+				"a.txt": map[string]any{"": map[string]any{"length": 5, "pieces root": strings.Repeat("r", 32)}},
+			},
+		}
+		tr, err := torrent.Parse(encode(t, map[string]any{"info": info}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		raw := encode(t, info)
+		if tr.InfoHash != sha1.Sum(raw) || tr.InfoHashV2 != sha256.Sum256(raw) {
+			t.Fatal("unexpected info hashes")
+		}
+	})
+
+	t.Run("v2 only", func(t *testing.T) {
+		info := map[string]any{
+			"name":         "dir",
+			"piece length": 16384,
+			"meta version": 2,
+			"file tree": map[string]any{
+				"b.txt": map[string]any{"": map[string]any{"length": 2}},
+				"sub": map[string]any{
+					"a.txt": map[string]any{"": map[string]any{"length": 1}},
+				},
+			},
+		}
+		tr, err := torrent.Parse(encode(t, map[string]any{"info": info}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tr.InfoHash != [20]byte{} || len(tr.InfoHashHex()) != 64 {
+			t.Fatal("unexpected info hash", tr.InfoHashHex())
+		}
+		want := []torrent.File{
+			{Index: 1, Path: "dir/b.txt", Length: 2},
+			{Index: 2, Path: "dir/sub/a.txt", Length: 1},
+		}
+		if !reflect.DeepEqual(tr.Files, want) {
+			t.Fatalf("unexpected files %+v", tr.Files)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, data := range [][]byte{
+			[]byte("not bencode"),
+			encode(t, map[string]any{"announce": "x"}),
+			encode(t, map[string]any{"info": map[string]any{"name": "x", "piece length": 1}}),
+			encode(t, map[string]any{"info": map[string]any{"piece length": 1, "pieces": "", "length": 1}}),
+			encode(t, map[string]any{"info": map[string]any{"name": "x", "piece length": 1, "pieces": ""}}),
+		} {
+			if _, err := torrent.Parse(data); !errors.Is(err, torrent.ErrInvalidTorrent) {
+				t.Fatalf("%q: expected an invalid torrent, got %v", data, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package ario
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kahosan/aria2-rpc/internal/units"
+)
+
+// ByteSize is a size in bytes, such as the value of min-split-size.
+type ByteSize int64
+
+const (
+	Byte ByteSize = 1
+	KiB           = 1024 * Byte
+	MiB           = 1024 * KiB
+	GiB           = 1024 * MiB
+)
+
+// ParseByteSize parses a size as aria2 writes it, a number of bytes with an
+// optional K or M suffix such as "20M", or as String formats it, e.g. "1.5GiB".
+func ParseByteSize(s string) (ByteSize, error) {
+	n, err := parseBytes(s, "")
+	return ByteSize(n), err
+}
+
+// MarshalText encodes s the way aria2 accepts it, e.g. "20M".
+func (s ByteSize) MarshalText() ([]byte, error) {
+	return []byte(formatBytes(int64(s))), nil
+}
+
+func (s *ByteSize) UnmarshalText(text []byte) error {
+	n, err := ParseByteSize(string(text))
+	*s = n
+	return err
+}
+
+// String formats the size with binary units, e.g. "1.5MiB".
+func (s ByteSize) String() string {
+	return units.Bytes(int64(s)) + "B"
+}
+
+// Speed is a transfer rate limit in bytes/sec, such as the value of
+// max-download-limit. 0 means unlimited.
+type Speed int64
+
+// ParseSpeed parses a speed as aria2 writes it, e.g. "512K", or as String
+// formats it, e.g. "1.5MiB/s".
+func ParseSpeed(s string) (Speed, error) {
+	n, err := parseBytes(s, "/s")
+	return Speed(n), err
+}
+
+// MarshalText encodes s the way aria2 accepts it, e.g. "512K".
+func (s Speed) MarshalText() ([]byte, error) {
+	return []byte(formatBytes(int64(s))), nil
+}
+
+func (s *Speed) UnmarshalText(text []byte) error {
+	n, err := ParseSpeed(string(text))
+	*s = n
+	return err
+}
+
+// String formats the speed with binary units, e.g. "1.5MiB/s".
+func (s Speed) String() string {
+	return units.Bytes(int64(s)) + "B/s"
+}
+
+// Duration is the value of a time based option, such as timeout or
+// seed-time. aria2 counts most of them in seconds, and seed-time in minutes,
+// the unit is taken care of when the options are encoded.
+type Duration time.Duration
+
+// String formats the duration like time.Duration, e.g. "1m30s".
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// formatDuration returns d as a number of units.
+func formatDuration(d Duration, unit time.Duration) string {
+	if d%Duration(unit) == 0 {
+		return strconv.FormatInt(int64(d)/int64(unit), 10)
+	}
+	return strconv.FormatFloat(float64(d)/float64(unit), 'f', -1, 64)
+}
+
+// parseDuration parses a number of units.
+func parseDuration(s string, unit time.Duration) (Duration, error) {
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return Duration(math.Round(n * float64(unit))), nil
+}
+
+// formatBytes returns n with the largest suffix aria2 accepts that keeps it
+// exact.
+func formatBytes(n int64) string {
+	switch {
+	case n != 0 && n%int64(MiB) == 0:
+		return strconv.FormatInt(n/int64(MiB), 10) + "M"
+	case n != 0 && n%int64(KiB) == 0:
+		return strconv.FormatInt(n/int64(KiB), 10) + "K"
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// parseBytes parses a number of bytes with an optional K, M, G or T prefix,
+// written as aria2 does ("20M") or with a binary unit ("1.5MiB"). suffix is
+// trimmed first if present.
+func parseBytes(s, suffix string) (int64, error) {
+	v := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), suffix))
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "iB"), "B")
+
+	mul := int64(1)
+	if i := len(v) - 1; i >= 0 {
+		if p := strings.IndexByte("KMGT", v[i]&^0x20); p >= 0 {
+			mul, v = 1<<(10*(p+1)), v[:i]
+		}
+	}
+
+	v = strings.TrimSpace(v)
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 {
+		if n > math.MaxInt64/mul {
+			return 0, fmt.Errorf("size %q overflows", s)
+		}
+		return n * mul, nil
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || !(f >= 0) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	if f*float64(mul) >= math.MaxInt64 {
+		return 0, fmt.Errorf("size %q overflows", s)
+	}
+	return int64(math.Round(f * float64(mul))), nil
+}